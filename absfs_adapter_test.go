@@ -3,6 +3,7 @@ package permfs
 import (
 	"context"
 	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -624,6 +625,94 @@ func TestAbsFileReaddirFallback(t *testing.T) {
 	}
 }
 
+func TestAbsAdapterListFilter(t *testing.T) {
+	mfs := seedMemFS(t, "/dir/a.txt", "/dir/b.txt", "/dir/c.txt", "/dir/d.txt", "/dir/e.txt")
+	pfs, _ := New(mfs, Config{
+		ACL: ACL{
+			Entries: []ACLEntry{
+				{
+					Subject:     User("alice"),
+					PathPattern: "/dir",
+					Permissions: Read,
+					Effect:      Allow,
+					Priority:    100,
+				},
+				{
+					Subject:     User("alice"),
+					PathPattern: "/dir/a.txt",
+					Permissions: Metadata,
+					Effect:      Allow,
+					Priority:    100,
+				},
+				{
+					Subject:     User("alice"),
+					PathPattern: "/dir/e.txt",
+					Permissions: Metadata,
+					Effect:      Allow,
+					Priority:    100,
+				},
+			},
+			Default: Deny,
+		},
+		Enforcement: EnforcementConfig{ListFilter: OperationMetadata},
+	})
+	adapter := NewAbsAdapter(pfs, &Identity{UserID: "alice"})
+	want := []string{"a.txt", "e.txt"}
+
+	t.Run("ReadDir", func(t *testing.T) {
+		entries, err := adapter.ReadDir("/dir")
+		if err != nil {
+			t.Fatalf("ReadDir failed: %v", err)
+		}
+		if len(entries) != 2 || entries[0].Name() != want[0] || entries[1].Name() != want[1] {
+			t.Errorf("expected %v, got %v", want, entries)
+		}
+	})
+
+	t.Run("handle Readdirnames", func(t *testing.T) {
+		f, err := adapter.Open("/dir")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+		names, err := f.Readdirnames(-1)
+		if err != nil {
+			t.Fatalf("Readdirnames failed: %v", err)
+		}
+		if len(names) != 2 || names[0] != want[0] || names[1] != want[1] {
+			t.Errorf("expected %v, got %v", want, names)
+		}
+	})
+
+	t.Run("handle ReadDir pages past hidden entries", func(t *testing.T) {
+		f, err := adapter.Open("/dir")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+
+		var got []string
+		for {
+			entries, err := f.ReadDir(1)
+			for _, entry := range entries {
+				got = append(got, entry.Name())
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("ReadDir failed: %v", err)
+			}
+			if len(entries) == 0 {
+				t.Fatal("ReadDir(1) returned no entries and no error")
+			}
+		}
+		if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+}
+
 // Extended mock that supports IsDir for Chdir testing
 type mockFileSystemWithDir struct {
 	mockFileSystem
@@ -0,0 +1,157 @@
+package permfs
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// Compile-time interface checks
+var (
+	_ FileSystem = (*absFSBridge)(nil)
+	_ File       = (*bridgedFile)(nil)
+)
+
+// absFSBridge adapts an absfs.FileSystem to the context-based FileSystem interface.
+// absfs has no notion of context, so cancellation is only observed before each
+// call is forwarded; an operation already in progress runs to completion.
+type absFSBridge struct {
+	fs absfs.FileSystem
+}
+
+// FromAbsFS wraps any absfs.FileSystem (memfs, osfs, s3fs, ...) so that it can be
+// used as the base filesystem passed to New.
+// If the filesystem also implements absfs.SymLinker, Lstat is forwarded to it;
+// otherwise Lstat falls back to Stat.
+func FromAbsFS(fsys absfs.FileSystem) FileSystem {
+	return &absFSBridge{fs: fsys}
+}
+
+// OpenFile opens a file with the specified flag and perm
+func (b *absFSBridge) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := b.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &bridgedFile{f}, nil
+}
+
+// Mkdir creates a directory
+func (b *absFSBridge) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.fs.Mkdir(name, perm)
+}
+
+// MkdirAll creates a directory and all parent directories
+func (b *absFSBridge) MkdirAll(ctx context.Context, name string, perm os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.fs.MkdirAll(name, perm)
+}
+
+// Remove removes a file or directory
+func (b *absFSBridge) Remove(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.fs.Remove(name)
+}
+
+// RemoveAll removes a path and any children it contains
+func (b *absFSBridge) RemoveAll(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.fs.RemoveAll(name)
+}
+
+// Rename renames (moves) a file
+func (b *absFSBridge) Rename(ctx context.Context, oldname, newname string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.fs.Rename(oldname, newname)
+}
+
+// Stat returns file info
+func (b *absFSBridge) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.fs.Stat(name)
+}
+
+// Lstat returns file info without following symlinks when the filesystem supports it
+func (b *absFSBridge) Lstat(ctx context.Context, name string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if linker, ok := b.fs.(absfs.SymLinker); ok {
+		return linker.Lstat(name)
+	}
+	return b.fs.Stat(name)
+}
+
+// ReadDir reads the directory and returns file info
+func (b *absFSBridge) ReadDir(ctx context.Context, name string) ([]os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entries, err := b.fs.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert []fs.DirEntry to []os.FileInfo
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Chmod changes the mode of the file
+func (b *absFSBridge) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.fs.Chmod(name, mode)
+}
+
+// Chown changes the owner and group of the file
+func (b *absFSBridge) Chown(ctx context.Context, name string, uid, gid int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.fs.Chown(name, uid, gid)
+}
+
+// Chtimes changes the access and modification times
+func (b *absFSBridge) Chtimes(ctx context.Context, name string, atime, mtime time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.fs.Chtimes(name, atime, mtime)
+}
+
+// bridgedFile wraps an absfs.File as a permfs.File.
+// Embedding keeps Name, Readdir, Readdirnames, ReadDir and WriteString
+// available to callers that type-assert for them.
+type bridgedFile struct {
+	absfs.File
+}
@@ -0,0 +1,172 @@
+package permfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// newTestAbsFS returns an absfs.FileSystem backed by a MemFS with unrestricted access
+func newTestAbsFS(t *testing.T) (absfs.FileSystem, *MemFS) {
+	t.Helper()
+	mfs := NewMemFS()
+	pfs, err := New(mfs, Config{ACL: ACL{Default: Allow}})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+	return NewAbsAdapter(pfs, &Identity{UserID: "root"}), mfs
+}
+
+// plainAbsFS hides every method outside absfs.FileSystem, including SymLinker
+type plainAbsFS struct {
+	absfs.FileSystem
+}
+
+func TestFromAbsFSOperations(t *testing.T) {
+	afs, mfs := newTestAbsFS(t)
+	base := FromAbsFS(afs)
+	ctx := context.Background()
+
+	if err := base.MkdirAll(ctx, "/a/b", 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := base.Mkdir(ctx, "/a/c", 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	f, err := base.OpenFile(ctx, "/a/b/file.txt", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	f.Write([]byte("bridged"))
+	f.Seek(0, io.SeekStart)
+	data, _ := io.ReadAll(f)
+	if string(data) != "bridged" {
+		t.Errorf("expected %q, got %q", "bridged", data)
+	}
+	if _, ok := f.(interface{ Readdirnames(int) ([]string, error) }); !ok {
+		t.Error("expected bridged file to expose Readdirnames")
+	}
+	f.Close()
+
+	infos, err := base.ReadDir(ctx, "/a")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(infos) != 2 || infos[0].Name() != "b" || infos[1].Name() != "c" {
+		t.Errorf("unexpected ReadDir result: %v", infos)
+	}
+
+	if err := base.Rename(ctx, "/a/b/file.txt", "/a/c/file.txt"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, err := mfs.Stat(ctx, "/a/c/file.txt"); err != nil {
+		t.Errorf("expected rename to reach the underlying filesystem: %v", err)
+	}
+
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := base.Chtimes(ctx, "/a/c/file.txt", mtime, mtime); err != nil {
+		t.Errorf("Chtimes failed: %v", err)
+	}
+	if err := base.Chmod(ctx, "/a/c/file.txt", 0600); err != nil {
+		t.Errorf("Chmod failed: %v", err)
+	}
+	if err := base.Chown(ctx, "/a/c/file.txt", 10, 20); err != nil {
+		t.Errorf("Chown failed: %v", err)
+	}
+	info, err := base.Lstat(ctx, "/a/c/file.txt")
+	if err != nil {
+		t.Fatalf("Lstat failed: %v", err)
+	}
+	if info.Mode() != 0600 || !info.ModTime().Equal(mtime) {
+		t.Errorf("unexpected metadata: mode=%v mtime=%v", info.Mode(), info.ModTime())
+	}
+	if owner := info.Sys().(*MemOwner); owner.Uid != 10 || owner.Gid != 20 {
+		t.Errorf("unexpected owner: %+v", owner)
+	}
+
+	if err := base.Remove(ctx, "/a/c/file.txt"); err != nil {
+		t.Errorf("Remove failed: %v", err)
+	}
+	if err := base.RemoveAll(ctx, "/a"); err != nil {
+		t.Errorf("RemoveAll failed: %v", err)
+	}
+	if _, err := base.Stat(ctx, "/a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestFromAbsFSLstatFallback(t *testing.T) {
+	afs, _ := newTestAbsFS(t)
+	base := FromAbsFS(plainAbsFS{afs})
+	ctx := context.Background()
+
+	info, err := base.Lstat(ctx, "/")
+	if err != nil {
+		t.Fatalf("Lstat fallback failed: %v", err)
+	}
+	if !info.IsDir() {
+		t.Error("expected root to be a directory")
+	}
+}
+
+func TestFromAbsFSContextCancelled(t *testing.T) {
+	afs, mfs := newTestAbsFS(t)
+	base := FromAbsFS(afs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := base.Mkdir(ctx, "/a", 0755); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := base.OpenFile(ctx, "/file.txt", os.O_CREATE|os.O_WRONLY, 0644); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := mfs.Stat(context.Background(), "/a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("cancelled call must not reach the underlying filesystem")
+	}
+}
+
+func TestPermFSOverAbsFS(t *testing.T) {
+	afs, _ := newTestAbsFS(t)
+	afs.MkdirAll("/home/alice", 0755)
+
+	pfs, err := New(FromAbsFS(afs), Config{
+		ACL: ACL{
+			Entries: []ACLEntry{
+				{
+					Subject:     User("alice"),
+					PathPattern: "/home/alice/**",
+					Permissions: ReadWrite,
+					Effect:      Allow,
+					Priority:    100,
+				},
+			},
+			Default: Deny,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+
+	ctx := WithUser(context.Background(), "alice")
+	f, err := pfs.OpenFile(ctx, "/home/alice/notes.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("expected alice to create her file: %v", err)
+	}
+	f.Close()
+
+	if _, err := afs.Stat("/home/alice/notes.txt"); err != nil {
+		t.Errorf("expected file in the absfs filesystem: %v", err)
+	}
+	if err := pfs.Mkdir(ctx, "/etc", 0755); !IsPermissionDenied(err) {
+		t.Errorf("expected permission denied, got %v", err)
+	}
+}
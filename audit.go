@@ -54,6 +54,8 @@ type AuditEvent struct {
 	Result AuditResult `json:"result"`
 	// Reason provides additional context for the result
 	Reason string `json:"reason,omitempty"`
+	// RuleID is the ID of the ACL entry that decided the result, if it has one
+	RuleID string `json:"rule_id,omitempty"`
 	// Duration is how long the permission check took
 	Duration time.Duration `json:"duration_ms"`
 	// Metadata contains additional context information
@@ -74,6 +76,7 @@ type AuditLogger struct {
 	wg           sync.WaitGroup
 	metrics      *AuditMetrics
 	handler      AuditHandler
+	clock        Clock
 }
 
 // AuditHandler is a function that processes audit events
@@ -133,7 +136,7 @@ func (al *AuditLogger) Log(event *AuditEvent) {
 
 	// Set timestamp if not already set
 	if event.Timestamp.IsZero() {
-		event.Timestamp = time.Now()
+		event.Timestamp = clockOrSystem(al.clock).Now()
 	}
 
 	// Update metrics
@@ -201,6 +201,8 @@ func NewPermFSWithAuthenticator(base FileSystem, config Config, auth Authenticat
 		evaluator:   pfs.evaluator,
 		config:      pfs.config,
 		auditLogger: pfs.auditLogger,
+		handles:     pfs.handles,
+		clock:       pfs.clock,
 	}, nil
 }
 
@@ -1,9 +1,11 @@
 package permfs
 
 import (
-	"container/list"
+	"encoding/binary"
 	"fmt"
+	"hash/maphash"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,167 +14,361 @@ type CacheKey struct {
 	UserID    string
 	Path      string
 	Operation Operation
+	// Fingerprint identifies the rest of the request a cached decision depends on;
+	// see requestFingerprint
+	Fingerprint uint64
 }
 
 // String returns a string representation of the cache key
 func (ck CacheKey) String() string {
-	return fmt.Sprintf("%s:%s:%d", ck.UserID, ck.Path, ck.Operation)
+	if ck.Fingerprint == 0 {
+		return fmt.Sprintf("%s:%s:%d", ck.UserID, ck.Path, ck.Operation)
+	}
+	return fmt.Sprintf("%s:%s:%d:%016x", ck.UserID, ck.Path, ck.Operation, ck.Fingerprint)
+}
+
+// fingerprintSeed keys request fingerprints; it is random per process
+var fingerprintSeed = maphash.MakeSeed()
+
+// requestFingerprint summarizes the parts of a request other than the user ID
+// that a cacheable decision can depend on: the identity's groups and roles, in
+// any order, and the values of the given metadata keys, which are only those
+// read by cache-safe conditions. It runs before every cache lookup, so it does
+// not allocate for the common metadata types. A group or role listed twice
+// gives a different fingerprint, which only costs a cache miss.
+func requestFingerprint(identity *Identity, metadata map[string]interface{}, keys []string) uint64 {
+	if len(identity.Groups) == 0 && len(identity.Roles) == 0 && len(keys) == 0 {
+		return 0
+	}
+
+	// Summing the hashes of the members makes the result independent of their order
+	var groups, roles uint64
+	for _, group := range identity.Groups {
+		groups += maphash.String(fingerprintSeed, group)
+	}
+	for _, role := range identity.Roles {
+		roles += maphash.String(fingerprintSeed, role)
+	}
+
+	var h maphash.Hash
+	h.SetSeed(fingerprintSeed)
+	writeUint64(&h, groups)
+	writeUint64(&h, roles)
+	for _, key := range keys {
+		h.WriteString(key)
+		value, ok := metadata[key]
+		switch v := value.(type) {
+		case string:
+			h.WriteByte('s')
+			h.WriteString(v)
+		case bool:
+			h.WriteByte('b')
+			if v {
+				h.WriteByte(1)
+			} else {
+				h.WriteByte(0)
+			}
+		case int:
+			h.WriteByte('i')
+			writeUint64(&h, uint64(v))
+		default:
+			if !ok {
+				h.WriteByte('-')
+			} else {
+				h.WriteString(fmt.Sprintf("%T:%#v", value, value))
+			}
+		}
+		h.WriteByte(0)
+	}
+	return h.Sum64()
+}
+
+// writeUint64 writes v to h in a fixed byte order
+func writeUint64(h *maphash.Hash, v uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	h.Write(buf[:])
 }
 
 // CacheEntry represents a cached permission evaluation result
 type CacheEntry struct {
 	Key       CacheKey
 	Allowed   bool
+	RuleID    string
+	Algorithm CombiningAlgorithm
 	ExpiresAt time.Time
-	element   *list.Element // For LRU tracking
+
+	// referenced is the CLOCK reference bit, set when the entry is read
+	referenced atomic.Bool
+	// slot is the entry's position in its shard's ring
+	slot int
 }
 
-// IsExpired checks if the cache entry has expired
+// IsExpired checks if the cache entry has expired by the system clock.
+//
+// Deprecated: the cache judges expiry by its own Clock, which may differ from
+// the system clock; IsExpired is kept only for existing callers.
 func (ce *CacheEntry) IsExpired() bool {
-	return time.Now().After(ce.ExpiresAt)
+	return ce.expiredAt(SystemClock.Now())
+}
+
+// expiredAt checks if the cache entry has expired at now
+func (ce *CacheEntry) expiredAt(now time.Time) bool {
+	return !now.Before(ce.ExpiresAt)
 }
 
-// PermissionCache provides LRU caching for permission evaluations
+const (
+	// maxCacheShards bounds the number of shards in a PermissionCache
+	maxCacheShards = 64
+	// minShardSize is the smallest capacity worth giving a shard of its own
+	minShardSize = 32
+)
+
+// PermissionCache caches permission evaluations. Entries are spread over
+// shards by a hash of their key so concurrent lookups rarely contend; a hit
+// only takes its shard's read lock. Each shard evicts with the CLOCK
+// algorithm, an approximation of LRU: entries read since the clock hand last
+// passed them get a second chance.
 type PermissionCache struct {
-	mu         sync.RWMutex
-	maxSize    int
-	ttl        time.Duration
-	entries    map[string]*CacheEntry
-	lruList    *list.List
-	hits       uint64
-	misses     uint64
-	evictions  uint64
-	enabled    bool
+	shards  []cacheShard
+	mask    uint64
+	seed    maphash.Seed
+	maxSize int
+	ttl     time.Duration
+	enabled atomic.Bool
+	clock   Clock
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// cacheShard is one independently locked part of a PermissionCache
+type cacheShard struct {
+	mu       sync.RWMutex
+	entries  map[CacheKey]*CacheEntry
+	ring     []*CacheEntry // entries in CLOCK order
+	hand     int
+	capacity int
+
+	// Keep neighbouring shards' locks on separate cache lines
+	_ [64]byte
 }
 
 // NewPermissionCache creates a new permission cache
 func NewPermissionCache(maxSize int, ttl time.Duration) *PermissionCache {
-	return &PermissionCache{
+	if maxSize < 1 {
+		maxSize = 1
+	}
+
+	count := 1
+	for count < maxCacheShards && maxSize/(count*2) >= minShardSize {
+		count *= 2
+	}
+
+	pc := &PermissionCache{
+		shards:  make([]cacheShard, count),
+		mask:    uint64(count - 1),
+		seed:    maphash.MakeSeed(),
 		maxSize: maxSize,
 		ttl:     ttl,
-		entries: make(map[string]*CacheEntry, maxSize),
-		lruList: list.New(),
-		enabled: true,
+		clock:   SystemClock,
+	}
+	for i := range pc.shards {
+		capacity := maxSize / count
+		if i < maxSize%count {
+			capacity++
+		}
+		pc.shards[i].capacity = capacity
+		pc.shards[i].entries = make(map[CacheKey]*CacheEntry, capacity)
+	}
+	pc.enabled.Store(true)
+	return pc
+}
+
+// shard returns the shard that holds key
+func (pc *PermissionCache) shard(key CacheKey) *cacheShard {
+	if len(pc.shards) == 1 {
+		return &pc.shards[0]
 	}
+
+	var h maphash.Hash
+	h.SetSeed(pc.seed)
+	h.WriteString(key.UserID)
+	h.WriteByte(0)
+	h.WriteString(key.Path)
+	h.WriteByte(0)
+	writeUint64(&h, key.Fingerprint)
+	h.WriteByte(byte(key.Operation))
+	return &pc.shards[h.Sum64()&pc.mask]
 }
 
 // Get retrieves a cached permission result
 func (pc *PermissionCache) Get(key CacheKey) (allowed bool, found bool) {
-	if !pc.enabled {
-		return false, false
+	decision, found := pc.GetDecision(key)
+	return decision.Allowed, found
+}
+
+// GetDecision retrieves a cached decision, including the deciding rule
+func (pc *PermissionCache) GetDecision(key CacheKey) (Decision, bool) {
+	if !pc.enabled.Load() {
+		return Decision{}, false
 	}
 
-	pc.mu.RLock()
-	entry, exists := pc.entries[key.String()]
-	pc.mu.RUnlock()
+	shard := pc.shard(key)
+	shard.mu.RLock()
+	entry, exists := shard.entries[key]
+	var decision Decision
+	var expiresAt time.Time
+	if exists {
+		decision = Decision{Allowed: entry.Allowed, RuleID: entry.RuleID, Algorithm: entry.Algorithm}
+		expiresAt = entry.ExpiresAt
+	}
+	shard.mu.RUnlock()
 
 	if !exists {
-		pc.mu.Lock()
-		pc.misses++
-		pc.mu.Unlock()
-		return false, false
+		pc.misses.Add(1)
+		return Decision{}, false
 	}
 
 	// Check expiration
-	if entry.IsExpired() {
-		pc.mu.Lock()
-		delete(pc.entries, key.String())
-		pc.lruList.Remove(entry.element)
-		pc.misses++
-		pc.mu.Unlock()
-		return false, false
+	if !pc.clock.Now().Before(expiresAt) {
+		shard.mu.Lock()
+		// The entry may have been replaced or refreshed meanwhile
+		if current, ok := shard.entries[key]; ok && current == entry && current.ExpiresAt.Equal(expiresAt) {
+			shard.remove(entry)
+		}
+		shard.mu.Unlock()
+		pc.misses.Add(1)
+		return Decision{}, false
 	}
 
-	// Move to front (most recently used)
-	pc.mu.Lock()
-	pc.lruList.MoveToFront(entry.element)
-	pc.hits++
-	pc.mu.Unlock()
-
-	return entry.Allowed, true
+	// Avoid writing to a shared cache line when the bit is already set
+	if !entry.referenced.Load() {
+		entry.referenced.Store(true)
+	}
+	pc.hits.Add(1)
+	return decision, true
 }
 
 // Set stores a permission result in the cache
 func (pc *PermissionCache) Set(key CacheKey, allowed bool) {
-	if !pc.enabled {
+	pc.SetDecision(key, Decision{Allowed: allowed})
+}
+
+// SetDecision stores a decision in the cache. The entry expires after the
+// cache TTL or at decision.ValidUntil, whichever comes first.
+func (pc *PermissionCache) SetDecision(key CacheKey, decision Decision) {
+	if !pc.enabled.Load() {
 		return
 	}
 
-	pc.mu.Lock()
-	defer pc.mu.Unlock()
+	now := pc.clock.Now()
+	expiresAt := now.Add(pc.ttl)
+	if !decision.ValidUntil.IsZero() && decision.ValidUntil.Before(expiresAt) {
+		expiresAt = decision.ValidUntil
+	}
 
-	keyStr := key.String()
+	shard := pc.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
 	// Check if entry already exists
-	if entry, exists := pc.entries[keyStr]; exists {
+	if entry, exists := shard.entries[key]; exists {
 		// Update existing entry
-		entry.Allowed = allowed
-		entry.ExpiresAt = time.Now().Add(pc.ttl)
-		pc.lruList.MoveToFront(entry.element)
+		entry.Allowed = decision.Allowed
+		entry.RuleID = decision.RuleID
+		entry.Algorithm = decision.Algorithm
+		entry.ExpiresAt = expiresAt
+		entry.referenced.Store(true)
 		return
 	}
 
-	// Evict if at capacity
-	if pc.lruList.Len() >= pc.maxSize {
-		pc.evictOldest()
-	}
-
-	// Add new entry
 	entry := &CacheEntry{
 		Key:       key,
-		Allowed:   allowed,
-		ExpiresAt: time.Now().Add(pc.ttl),
+		Allowed:   decision.Allowed,
+		RuleID:    decision.RuleID,
+		Algorithm: decision.Algorithm,
+		ExpiresAt: expiresAt,
 	}
 
-	entry.element = pc.lruList.PushFront(entry)
-	pc.entries[keyStr] = entry
+	// Evict if at capacity
+	if len(shard.ring) >= shard.capacity {
+		shard.evict(now)
+		pc.evictions.Add(1)
+	}
+	entry.slot = len(shard.ring)
+	shard.ring = append(shard.ring, entry)
+	shard.entries[key] = entry
 }
 
-// evictOldest removes the least recently used entry
-func (pc *PermissionCache) evictOldest() {
-	if pc.lruList.Len() == 0 {
+// evict removes one entry, advancing the clock hand past referenced entries
+// and clearing their reference bits. Expired entries are taken first. The
+// shard must be locked and not empty.
+func (s *cacheShard) evict(now time.Time) {
+	for {
+		if s.hand >= len(s.ring) {
+			s.hand = 0
+		}
+		entry := s.ring[s.hand]
+		if entry.referenced.Load() && !entry.expiredAt(now) {
+			entry.referenced.Store(false)
+			s.hand++
+			continue
+		}
+		s.remove(entry)
 		return
 	}
+}
 
-	oldest := pc.lruList.Back()
-	if oldest == nil {
-		return
-	}
+// remove deletes an entry from the shard, which must be locked. The last
+// entry of the ring takes the freed slot.
+func (s *cacheShard) remove(entry *CacheEntry) {
+	delete(s.entries, entry.Key)
+
+	last := len(s.ring) - 1
+	moved := s.ring[last]
+	s.ring[entry.slot] = moved
+	moved.slot = entry.slot
+	s.ring[last] = nil
+	s.ring = s.ring[:last]
+}
 
-	entry := oldest.Value.(*CacheEntry)
-	delete(pc.entries, entry.Key.String())
-	pc.lruList.Remove(oldest)
-	pc.evictions++
+// Delete removes a single entry from the cache
+func (pc *PermissionCache) Delete(key CacheKey) {
+	shard := pc.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if entry, exists := shard.entries[key]; exists {
+		shard.remove(entry)
+	}
 }
 
 // Clear removes all entries from the cache
 func (pc *PermissionCache) Clear() {
-	pc.mu.Lock()
-	defer pc.mu.Unlock()
-
-	pc.entries = make(map[string]*CacheEntry, pc.maxSize)
-	pc.lruList.Init()
+	for i := range pc.shards {
+		shard := &pc.shards[i]
+		shard.mu.Lock()
+		shard.entries = make(map[CacheKey]*CacheEntry, shard.capacity)
+		shard.ring = nil
+		shard.hand = 0
+		shard.mu.Unlock()
+	}
 }
 
 // Invalidate removes entries matching a pattern
 func (pc *PermissionCache) Invalidate(userID string, pathPrefix string) {
-	pc.mu.Lock()
-	defer pc.mu.Unlock()
-
-	toRemove := []string{}
-
-	for keyStr, entry := range pc.entries {
-		if (userID == "" || entry.Key.UserID == userID) &&
-			(pathPrefix == "" || matchesPrefix(entry.Key.Path, pathPrefix)) {
-			toRemove = append(toRemove, keyStr)
-		}
-	}
-
-	for _, keyStr := range toRemove {
-		if entry, exists := pc.entries[keyStr]; exists {
-			delete(pc.entries, keyStr)
-			pc.lruList.Remove(entry.element)
+	for i := range pc.shards {
+		shard := &pc.shards[i]
+		shard.mu.Lock()
+		for key, entry := range shard.entries {
+			if (userID == "" || key.UserID == userID) &&
+				(pathPrefix == "" || matchesPrefix(key.Path, pathPrefix)) {
+				shard.remove(entry)
+			}
 		}
+		shard.mu.Unlock()
 	}
 }
 
@@ -189,47 +385,47 @@ func matchesPrefix(path, prefix string) bool {
 
 // Stats returns cache statistics
 func (pc *PermissionCache) Stats() CacheStats {
-	pc.mu.RLock()
-	defer pc.mu.RUnlock()
+	size := 0
+	for i := range pc.shards {
+		shard := &pc.shards[i]
+		shard.mu.RLock()
+		size += len(shard.ring)
+		shard.mu.RUnlock()
+	}
 
+	hits, misses := pc.hits.Load(), pc.misses.Load()
 	return CacheStats{
-		Size:      pc.lruList.Len(),
+		Size:      size,
 		MaxSize:   pc.maxSize,
-		Hits:      pc.hits,
-		Misses:    pc.misses,
-		Evictions: pc.evictions,
-		HitRate:   pc.hitRate(),
+		Hits:      hits,
+		Misses:    misses,
+		Evictions: pc.evictions.Load(),
+		HitRate:   hitRate(hits, misses),
 	}
 }
 
 // hitRate calculates the cache hit rate
-func (pc *PermissionCache) hitRate() float64 {
-	total := pc.hits + pc.misses
+func hitRate(hits, misses uint64) float64 {
+	total := hits + misses
 	if total == 0 {
 		return 0
 	}
-	return float64(pc.hits) / float64(total)
+	return float64(hits) / float64(total)
 }
 
 // Enable enables the cache
 func (pc *PermissionCache) Enable() {
-	pc.mu.Lock()
-	defer pc.mu.Unlock()
-	pc.enabled = true
+	pc.enabled.Store(true)
 }
 
 // Disable disables the cache
 func (pc *PermissionCache) Disable() {
-	pc.mu.Lock()
-	defer pc.mu.Unlock()
-	pc.enabled = false
+	pc.enabled.Store(false)
 }
 
 // IsEnabled returns whether the cache is enabled
 func (pc *PermissionCache) IsEnabled() bool {
-	pc.mu.RLock()
-	defer pc.mu.RUnlock()
-	return pc.enabled
+	return pc.enabled.Load()
 }
 
 // CacheStats contains cache statistics
@@ -240,6 +436,11 @@ type CacheStats struct {
 	Misses    uint64
 	Evictions uint64
 	HitRate   float64
+
+	// Pattern cache statistics, filled in by Evaluator.GetCacheStats
+	PatternCacheSize int
+	PatternHits      uint64
+	PatternMisses    uint64
 }
 
 // PatternCache caches compiled path patterns
@@ -247,6 +448,8 @@ type PatternCache struct {
 	mu      sync.RWMutex
 	cache   map[string]*PatternMatcher
 	enabled bool
+	hits    atomic.Uint64
+	misses  atomic.Uint64
 }
 
 // NewPatternCache creates a new pattern cache
@@ -267,6 +470,11 @@ func (pc *PatternCache) Get(pattern string) (*PatternMatcher, bool) {
 	defer pc.mu.RUnlock()
 
 	matcher, exists := pc.cache[pattern]
+	if exists {
+		pc.hits.Add(1)
+	} else {
+		pc.misses.Add(1)
+	}
 	return matcher, exists
 }
 
@@ -301,6 +509,21 @@ func (pc *PatternCache) GetOrCreate(pattern string) (*PatternMatcher, error) {
 	return matcher, nil
 }
 
+// compile returns the cached matcher for pattern, compiling and caching it on a
+// miss. Unlike GetOrCreate it accepts malformed patterns, and a nil cache simply
+// compiles.
+func (pc *PatternCache) compile(pattern string) *PatternMatcher {
+	if pc == nil {
+		return compilePattern(pattern)
+	}
+	if matcher, exists := pc.Get(pattern); exists {
+		return matcher
+	}
+	matcher := compilePattern(pattern)
+	pc.Set(pattern, matcher)
+	return matcher
+}
+
 // Clear removes all cached patterns
 func (pc *PatternCache) Clear() {
 	pc.mu.Lock()
@@ -316,3 +539,14 @@ func (pc *PatternCache) Size() int {
 
 	return len(pc.cache)
 }
+
+// Stats returns the size and hit statistics of the pattern cache
+func (pc *PatternCache) Stats() CacheStats {
+	hits, misses := pc.hits.Load(), pc.misses.Load()
+	return CacheStats{
+		Size:    pc.Size(),
+		Hits:    hits,
+		Misses:  misses,
+		HitRate: hitRate(hits, misses),
+	}
+}
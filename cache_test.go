@@ -1,6 +1,9 @@
 package permfs
 
 import (
+	"container/list"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 )
@@ -292,6 +295,19 @@ func TestPatternCache(t *testing.T) {
 			t.Errorf("Expected size 5, got %d", cache.Size())
 		}
 	})
+
+	t.Run("stats", func(t *testing.T) {
+		cache := NewPatternCache()
+
+		cache.GetOrCreate("/data/**")
+		cache.GetOrCreate("/data/**")
+		cache.GetOrCreate("/home/*")
+
+		stats := cache.Stats()
+		if stats.Size != 2 || stats.Hits != 1 || stats.Misses != 2 {
+			t.Errorf("Expected size 2, 1 hit and 2 misses, got %+v", stats)
+		}
+	})
 }
 
 func TestCacheKeyString(t *testing.T) {
@@ -360,6 +376,27 @@ func TestCacheEntryIsExpired(t *testing.T) {
 	}
 }
 
+func TestCacheEntryExpiredAt(t *testing.T) {
+	now := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+	entry := &CacheEntry{
+		ExpiresAt: now.Add(-1 * time.Second),
+	}
+
+	if !entry.expiredAt(now) {
+		t.Error("Expected entry to be expired")
+	}
+
+	entry.ExpiresAt = now.Add(1 * time.Hour)
+	if entry.expiredAt(now) {
+		t.Error("Expected entry to not be expired")
+	}
+
+	entry.ExpiresAt = now
+	if !entry.expiredAt(now) {
+		t.Error("Expected entry to be expired at its expiry instant")
+	}
+}
+
 func TestPermissionCacheUpdateExisting(t *testing.T) {
 	cache := NewPermissionCache(5, 1*time.Minute)
 	key := CacheKey{UserID: "alice", Path: "/file.txt", Operation: OperationRead}
@@ -408,3 +445,333 @@ func BenchmarkCacheSet(b *testing.B) {
 		cache.Set(key, true)
 	}
 }
+
+func TestCacheKeyIdentityAware(t *testing.T) {
+	ipOnly, err := NewIPCondition([]string{"10.0.0.0/8"}, nil)
+	if err != nil {
+		t.Fatalf("NewIPCondition failed: %v", err)
+	}
+	calls := 0
+	acl := ACL{
+		Entries: []ACLEntry{
+			{Subject: Group("eng"), PathPattern: "/src/**", Permissions: Read, Effect: Allow},
+			{Subject: Role("ops"), PathPattern: "/ops/**", Permissions: Read, Effect: Allow, Conditions: []Condition{ipOnly}},
+			{Subject: Everyone(), PathPattern: "/lab/**", Permissions: Read, Effect: Allow, Conditions: []Condition{
+				NewFuncCondition("counted", func(*EvaluationContext) bool { calls++; return true }),
+			}},
+		},
+		Default: Deny,
+	}
+	cache := NewPermissionCache(100, time.Minute)
+	e := NewEvaluatorWithCache(acl, cache, nil)
+
+	check := func(identity *Identity, path, ip string, want bool) {
+		t.Helper()
+		ctx := &EvaluationContext{Identity: identity, Path: path, Operation: OperationRead}
+		if ip != "" {
+			ctx.Metadata = map[string]interface{}{"source_ip": ip}
+		}
+		if got, _ := e.Evaluate(ctx); got != want {
+			t.Errorf("%+v reading %s from %q: got %v, want %v", identity, path, ip, got, want)
+		}
+	}
+
+	// Groups and roles are part of the key, in any order
+	check(&Identity{UserID: "alice", Groups: []string{"eng", "qa"}}, "/src/main.go", "", true)
+	check(&Identity{UserID: "alice", Groups: []string{"qa"}}, "/src/main.go", "", false)
+	check(&Identity{UserID: "alice", Groups: []string{"qa", "eng"}}, "/src/main.go", "", true)
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Size != 2 {
+		t.Errorf("expected reordered groups to hit the cache, got %+v", stats)
+	}
+
+	// Metadata read by cache-safe conditions is part of the key
+	ops := &Identity{UserID: "bob", Roles: []string{"ops"}}
+	check(ops, "/ops/runbook.md", "10.1.2.3", true)
+	check(ops, "/ops/runbook.md", "192.168.1.1", false)
+	check(ops, "/ops/runbook.md", "", false)
+
+	// Decisions involving other conditions are never cached
+	for i := 0; i < 3; i++ {
+		check(ops, "/lab/notes", "", true)
+	}
+	if calls != 3 {
+		t.Errorf("expected the uncacheable condition to run on every request, ran %d times", calls)
+	}
+}
+
+func TestPermissionCacheClockEviction(t *testing.T) {
+	cache := NewPermissionCache(3, time.Minute)
+	keys := make([]CacheKey, 4)
+	for i := range keys {
+		keys[i] = CacheKey{UserID: "user", Path: fmt.Sprintf("/file%d", i), Operation: OperationRead}
+	}
+
+	for _, key := range keys[:3] {
+		cache.Set(key, true)
+	}
+	// Reading the oldest entry gives it a second chance
+	cache.Get(keys[0])
+	cache.Set(keys[3], true)
+
+	for i, want := range []bool{true, false, true, true} {
+		if _, found := cache.Get(keys[i]); found != want {
+			t.Errorf("key %d: found=%v, want %v", i, found, want)
+		}
+	}
+	if stats := cache.Stats(); stats.Size != 3 || stats.Evictions != 1 {
+		t.Errorf("expected 3 entries and 1 eviction, got %+v", stats)
+	}
+}
+
+func TestPermissionCacheSharded(t *testing.T) {
+	cache := NewPermissionCache(1000, time.Minute)
+	if len(cache.shards) < 2 {
+		t.Fatalf("expected a large cache to be sharded, got %d shard(s)", len(cache.shards))
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := CacheKey{UserID: fmt.Sprintf("user%d", g), Path: fmt.Sprintf("/file%d", i), Operation: OperationRead}
+				cache.Set(key, i%2 == 0)
+				if allowed, found := cache.Get(key); found && allowed != (i%2 == 0) {
+					t.Errorf("%v: got allowed=%v", key, allowed)
+				}
+				if i%100 == 0 {
+					cache.Invalidate(fmt.Sprintf("user%d", (g+1)%8), "/file1")
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	stats := cache.Stats()
+	if stats.Size > stats.MaxSize {
+		t.Errorf("cache holds %d entries, more than its maximum of %d", stats.Size, stats.MaxSize)
+	}
+	if stats.Hits+stats.Misses != 8*500 {
+		t.Errorf("expected %d lookups to be counted, got %+v", 8*500, stats)
+	}
+
+	cache.Clear()
+	if size := cache.Stats().Size; size != 0 {
+		t.Errorf("expected an empty cache after Clear, got %d entries", size)
+	}
+}
+
+// mutexLRUCache is the previous PermissionCache implementation: one mutex and
+// an exact LRU list keyed by CacheKey.String(). It is kept for the benchmarks.
+type mutexLRUCache struct {
+	mu      sync.RWMutex
+	maxSize int
+	ttl     time.Duration
+	entries map[string]*mutexLRUEntry
+	lruList *list.List
+	hits    uint64
+	misses  uint64
+}
+
+type mutexLRUEntry struct {
+	key       CacheKey
+	decision  Decision
+	expiresAt time.Time
+	element   *list.Element
+}
+
+func newMutexLRUCache(maxSize int, ttl time.Duration) *mutexLRUCache {
+	return &mutexLRUCache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		entries: make(map[string]*mutexLRUEntry, maxSize),
+		lruList: list.New(),
+	}
+}
+
+func (c *mutexLRUCache) GetDecision(key CacheKey) (Decision, bool) {
+	keyStr := key.String()
+	c.mu.RLock()
+	entry, exists := c.entries[keyStr]
+	var decision Decision
+	var expiresAt time.Time
+	if exists {
+		decision, expiresAt = entry.decision, entry.expiresAt
+	}
+	c.mu.RUnlock()
+
+	if !exists {
+		c.mu.Lock()
+		c.misses++
+		c.mu.Unlock()
+		return Decision{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !time.Now().Before(expiresAt) {
+		if current, ok := c.entries[keyStr]; ok && current == entry {
+			delete(c.entries, keyStr)
+			c.lruList.Remove(entry.element)
+		}
+		c.misses++
+		return Decision{}, false
+	}
+	c.lruList.MoveToFront(entry.element)
+	c.hits++
+	return decision, true
+}
+
+func (c *mutexLRUCache) SetDecision(key CacheKey, decision Decision) {
+	expiresAt := time.Now().Add(c.ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keyStr := key.String()
+	if entry, exists := c.entries[keyStr]; exists {
+		entry.decision = decision
+		entry.expiresAt = expiresAt
+		c.lruList.MoveToFront(entry.element)
+		return
+	}
+
+	if c.lruList.Len() >= c.maxSize {
+		oldest := c.lruList.Back()
+		delete(c.entries, oldest.Value.(*mutexLRUEntry).key.String())
+		c.lruList.Remove(oldest)
+	}
+
+	entry := &mutexLRUEntry{key: key, decision: decision, expiresAt: expiresAt}
+	entry.element = c.lruList.PushFront(entry)
+	c.entries[keyStr] = entry
+}
+
+type decisionCache interface {
+	GetDecision(key CacheKey) (Decision, bool)
+	SetDecision(key CacheKey, decision Decision)
+}
+
+// BenchmarkCacheParallel compares the sharded cache with the previous single
+// mutex LRU under concurrent load: 4096 hot keys, one write per 16 operations.
+// Run with -cpu 1,2,4,8 to see how throughput scales with GOMAXPROCS.
+func BenchmarkCacheParallel(b *testing.B) {
+	keys := make([]CacheKey, 4096)
+	for i := range keys {
+		keys[i] = CacheKey{UserID: fmt.Sprintf("user%d", i%64), Path: fmt.Sprintf("/data/file%d.txt", i), Operation: OperationRead}
+	}
+
+	implementations := []struct {
+		name  string
+		cache func() decisionCache
+	}{
+		{"sharded", func() decisionCache { return NewPermissionCache(10000, 5*time.Minute) }},
+		{"mutex-lru", func() decisionCache { return newMutexLRUCache(10000, 5*time.Minute) }},
+	}
+	for _, impl := range implementations {
+		b.Run(impl.name, func(b *testing.B) {
+			cache := impl.cache()
+			for _, key := range keys {
+				cache.SetDecision(key, Decision{Allowed: true})
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[(i*7919)%len(keys)]
+					if i%16 == 0 {
+						cache.SetDecision(key, Decision{Allowed: true})
+					} else {
+						cache.GetDecision(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestDecideCacheHitDoesNotAllocate(t *testing.T) {
+	acl := ACL{
+		Entries: []ACLEntry{
+			{Subject: Group("eng"), PathPattern: "/src/**", Permissions: Read, Effect: Allow,
+				Conditions: []Condition{&MetadataCondition{Key: "env", Values: []string{"prod"}}}},
+		},
+		Default: Deny,
+	}
+	e := NewEvaluatorWithCache(acl, NewPermissionCache(100, time.Minute), nil)
+	ctx := &EvaluationContext{
+		Identity:  &Identity{UserID: "alice", Groups: []string{"qa", "eng"}, Roles: []string{"dev"}},
+		Path:      "/src/main.go",
+		Operation: OperationRead,
+		Metadata:  map[string]interface{}{"env": "prod", "source_ip": "10.0.0.1"},
+	}
+	if allowed, _ := e.Evaluate(ctx); !allowed {
+		t.Fatal("expected access to be allowed")
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { e.Decide(ctx) }); allocs != 0 {
+		t.Errorf("expected a cache hit not to allocate, got %v allocations", allocs)
+	}
+}
+
+// BenchmarkDecideParallel measures whole permission checks through Decide,
+// including the cache key fingerprint, for an identity with groups, roles and
+// metadata read by a condition. Run with -cpu 1,2,4,8 to see the scaling.
+func BenchmarkDecideParallel(b *testing.B) {
+	var entries []ACLEntry
+	for i := 0; i < 200; i++ {
+		entries = append(entries, ACLEntry{
+			Subject:     Group(fmt.Sprintf("team%d", i%20)),
+			PathPattern: fmt.Sprintf("/projects/p%d/**", i),
+			Permissions: ReadWrite,
+			Effect:      Allow,
+			Conditions:  []Condition{&MetadataCondition{Key: "env", Values: []string{"prod"}}},
+		})
+	}
+	acl := ACL{Entries: entries, Default: Deny}
+
+	contexts := make([]*EvaluationContext, 1024)
+	for i := range contexts {
+		contexts[i] = &EvaluationContext{
+			Identity: &Identity{
+				UserID: fmt.Sprintf("user%d", i%64),
+				Groups: []string{"staff", fmt.Sprintf("team%d", i%20)},
+				Roles:  []string{"developer"},
+			},
+			Path:      fmt.Sprintf("/projects/p%d/src/file%d.go", i%200, i),
+			Operation: OperationRead,
+			Metadata:  map[string]interface{}{"env": "prod", "source_ip": "10.0.0.1"},
+		}
+	}
+
+	evaluators := []struct {
+		name      string
+		evaluator func() *Evaluator
+	}{
+		{"cached", func() *Evaluator {
+			return NewEvaluatorWithCache(acl, NewPermissionCache(10000, 5*time.Minute), NewPatternCache())
+		}},
+		{"uncached", func() *Evaluator { return NewEvaluator(acl) }},
+	}
+	for _, ev := range evaluators {
+		b.Run(ev.name, func(b *testing.B) {
+			e := ev.evaluator()
+			for _, ctx := range contexts {
+				e.Decide(ctx)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					e.Decide(contexts[(i*7919)%len(contexts)])
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package permfs
+
+import "time"
+
+// Clock tells the current time. It lets time-based rules, cache expiry and
+// audit timestamps be driven by something other than the system clock, such
+// as a fake clock in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock backed by time.Now
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+// Now returns the current system time
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// clockOrSystem returns c, or SystemClock if c is nil
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
@@ -0,0 +1,261 @@
+package permfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/absfs/permfs/permfstest"
+)
+
+var _ Clock = (*permfstest.FakeClock)(nil)
+
+func TestClockBusinessHours(t *testing.T) {
+	// Monday 08:30 UTC
+	clock := permfstest.NewFakeClock(time.Date(2026, 5, 4, 8, 30, 0, 0, time.UTC))
+	var events []*AuditEvent
+	pfs, err := New(&mockFileSystem{shouldReturnFile: true}, Config{
+		ACL: ACL{
+			Entries: []ACLEntry{
+				{
+					Subject:     User("alice"),
+					PathPattern: "/office/**",
+					Permissions: Read,
+					Effect:      Allow,
+					Conditions: []Condition{&TimeCondition{
+						AllowedHours: []HourRange{{Start: 9, End: 17}},
+						AllowedDays:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+						Timezone:     time.UTC,
+					}},
+				},
+			},
+			Default: Deny,
+		},
+		Audit: AuditConfig{
+			Enabled: true,
+			Writer:  io.Discard,
+			Handler: func(event *AuditEvent) { events = append(events, event) },
+		},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+	ctx := WithUser(context.Background(), "alice")
+
+	steps := []struct {
+		advance time.Duration
+		allowed bool
+	}{
+		{0, false},                  // Monday 08:30
+		{time.Hour, true},           // Monday 09:30
+		{5 * 24 * time.Hour, false}, // Saturday 09:30
+	}
+	for i, step := range steps {
+		now := clock.Advance(step.advance)
+		_, err := pfs.OpenFile(ctx, "/office/plan.txt", os.O_RDONLY, 0)
+		if allowed := err == nil; allowed != step.allowed {
+			t.Errorf("step %d at %v: expected allowed=%v, got %v", i, now, step.allowed, err)
+		}
+		if got := events[len(events)-1].Timestamp; !got.Equal(now) {
+			t.Errorf("step %d: audit timestamp %v, want %v", i, got, now)
+		}
+	}
+}
+
+func TestClockCacheTTL(t *testing.T) {
+	clock := permfstest.NewFakeClock(time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC))
+	pfs, err := New(&mockFileSystem{shouldReturnFile: true}, Config{
+		ACL: ACL{
+			Entries: []ACLEntry{{Subject: User("alice"), PathPattern: "/data/**", Permissions: Read, Effect: Allow}},
+			Default: Deny,
+		},
+		Performance: PerformanceConfig{
+			CacheEnabled: true,
+			CacheTTL:     time.Minute,
+			CacheMaxSize: 100,
+		},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+	ctx := WithUser(context.Background(), "alice")
+
+	read := func() {
+		if _, err := pfs.OpenFile(ctx, "/data/a.txt", os.O_RDONLY, 0); err != nil {
+			t.Fatalf("unexpected denial: %v", err)
+		}
+	}
+
+	read()
+	clock.Advance(30 * time.Second)
+	read()
+	if stats := pfs.GetCacheStats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("expected a hit within the TTL, got %+v", stats)
+	}
+
+	clock.Advance(time.Minute)
+	read()
+	if stats := pfs.GetCacheStats(); stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("expected a miss after the TTL, got %+v", stats)
+	}
+}
+
+func TestClockRuleExpiry(t *testing.T) {
+	start := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+	clock := permfstest.NewFakeClock(start)
+	pfs, err := New(&mockFileSystem{shouldReturnFile: true}, Config{
+		ACL: ACL{
+			Entries: []ACLEntry{
+				{ID: "incident", Subject: User("alice"), PathPattern: "/ops/**", Permissions: Read, Effect: Allow,
+					NotBefore: start.Add(time.Hour), NotAfter: start.Add(2 * time.Hour)},
+			},
+			Default: Deny,
+		},
+		Performance: PerformanceConfig{
+			CacheEnabled: true,
+			CacheTTL:     time.Hour,
+			CacheMaxSize: 100,
+		},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+	ctx := WithUser(context.Background(), "alice")
+
+	steps := []struct {
+		at      time.Duration
+		allowed bool
+	}{
+		{0, false},
+		{59 * time.Minute, false},
+		{time.Hour, true},
+		{119 * time.Minute, true},
+		{2 * time.Hour, false},
+	}
+	for _, step := range steps {
+		clock.Set(start.Add(step.at))
+		_, err := pfs.OpenFile(ctx, "/ops/runbook.md", os.O_RDONLY, 0)
+		if allowed := err == nil; allowed != step.allowed {
+			t.Errorf("at +%v: expected allowed=%v, got %v", step.at, step.allowed, err)
+		}
+	}
+
+	if expired := pfs.PruneExpiredRules(); len(expired) != 1 || expired[0].ID != "incident" {
+		t.Errorf("expected the incident rule to be pruned, got %v", expired)
+	}
+}
+
+// sessionCondition lets decisions be cached only while a session is pinned
+type sessionCondition struct{ pinned bool }
+
+func (c *sessionCondition) Evaluate(*EvaluationContext) bool { return true }
+func (c *sessionCondition) String() string                   { return "SessionCondition" }
+func (c *sessionCondition) CacheSafe() bool                  { return true }
+func (c *sessionCondition) MetadataKeys() []string           { return nil }
+
+func (c *sessionCondition) CacheHint(*EvaluationContext) (bool, time.Time) {
+	return c.pinned, time.Time{}
+}
+
+func TestClockConditionCacheHints(t *testing.T) {
+	// Monday 17:50 UTC; business hours end at 17:59
+	clock := permfstest.NewFakeClock(time.Date(2026, 5, 4, 17, 50, 0, 0, time.UTC))
+	session := &sessionCondition{}
+	pfs, err := New(&mockFileSystem{shouldReturnFile: true}, Config{
+		ACL: ACL{
+			Entries: []ACLEntry{
+				{Subject: User("alice"), PathPattern: "/office/**", Permissions: Read, Effect: Allow,
+					Conditions: []Condition{NewBusinessHoursCondition()}},
+				{Subject: User("alice"), PathPattern: "/session/**", Permissions: Read, Effect: Allow,
+					Conditions: []Condition{session}},
+			},
+			Default: Deny,
+		},
+		Performance: PerformanceConfig{
+			CacheEnabled: true,
+			CacheTTL:     5 * time.Minute,
+			CacheMaxSize: 100,
+		},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+	ctx := WithUser(context.Background(), "alice")
+	read := func(path string) bool {
+		_, err := pfs.OpenFile(ctx, path, os.O_RDONLY, 0)
+		return err == nil
+	}
+
+	if !read("/office/plan.txt") {
+		t.Fatal("expected access during business hours")
+	}
+	clock.Advance(2 * time.Minute)
+	if !read("/office/plan.txt") {
+		t.Fatal("expected access during business hours")
+	}
+	if stats := pfs.GetCacheStats(); stats.Hits != 1 {
+		t.Errorf("expected a cache hit within the hour, got %+v", stats)
+	}
+
+	// 18:01 is within the cache TTL of the first check but past the hour boundary
+	clock.Advance(9 * time.Minute)
+	if read("/office/plan.txt") {
+		t.Error("expected the cached allow to end at the hour boundary")
+	}
+
+	// A condition that reports itself uncacheable keeps its decisions out of the cache
+	hits := pfs.GetCacheStats().Hits
+	read("/session/a")
+	read("/session/a")
+	if stats := pfs.GetCacheStats(); stats.Hits != hits {
+		t.Errorf("expected no cache hits for an uncacheable condition, got %+v", stats)
+	}
+	session.pinned = true
+	read("/session/a")
+	read("/session/a")
+	if stats := pfs.GetCacheStats(); stats.Hits != hits+1 {
+		t.Errorf("expected a cache hit once the condition is cacheable, got %+v", stats)
+	}
+}
+
+func TestClockMatchingEntries(t *testing.T) {
+	clock := permfstest.NewFakeClock(time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC))
+	pfs, err := New(&mockFileSystem{shouldReturnFile: true}, Config{
+		ACL: ACL{
+			Entries: []ACLEntry{
+				{
+					Subject:     User("alice"),
+					PathPattern: "/data/**",
+					Permissions: Read,
+					Effect:      Allow,
+					NotAfter:    time.Date(2035, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+			Default: Deny,
+		},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+
+	// A context without a time is judged by the evaluator's clock, not the system's
+	ctx := &EvaluationContext{Identity: &Identity{UserID: "alice"}, Path: "/data/a", Operation: OperationRead}
+	if matching := pfs.evaluator.GetMatchingEntries(ctx); len(matching) != 0 {
+		t.Errorf("expected the rule to have expired by the evaluator's clock, got %v", matching)
+	}
+	if allowed, result := pfs.TestPermission(ctx.Identity, ctx.Path, ctx.Operation); allowed || len(result.MatchingEntries) != 0 {
+		t.Errorf("expected TestPermission to agree, got allowed=%v with %v", allowed, result.MatchingEntries)
+	}
+
+	clock.Set(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	if matching := pfs.evaluator.GetMatchingEntries(ctx); len(matching) != 1 {
+		t.Errorf("expected the rule to match before it expires, got %v", matching)
+	}
+}
@@ -0,0 +1,154 @@
+package permfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CombiningAlgorithm selects how the decisions of several matching rules are combined
+type CombiningAlgorithm int
+
+const (
+	// CombinePriority lets the highest priority rules decide; on a tie deny beats allow.
+	// This is the default.
+	CombinePriority CombiningAlgorithm = iota
+	// CombineDenyOverrides denies if any matching rule denies, regardless of priority
+	CombineDenyOverrides
+	// CombinePermitOverrides allows if any matching rule allows, regardless of priority
+	CombinePermitOverrides
+	// CombineFirstApplicable uses the first matching rule in ACL order
+	CombineFirstApplicable
+	// CombineMostSpecific lets the rule with the most specific path pattern decide
+	// (see PatternSpecificity); ties are resolved by priority, then deny beats allow
+	CombineMostSpecific
+	// CombinePrioritySpecific lets the highest priority rules decide; on a tie the
+	// most specific pattern wins, then deny beats allow
+	CombinePrioritySpecific
+)
+
+// String returns the name of the algorithm as used in policy files
+func (c CombiningAlgorithm) String() string {
+	switch c {
+	case CombinePriority:
+		return "priority"
+	case CombineDenyOverrides:
+		return "deny-overrides"
+	case CombinePermitOverrides:
+		return "permit-overrides"
+	case CombineFirstApplicable:
+		return "first-applicable"
+	case CombineMostSpecific:
+		return "most-specific"
+	case CombinePrioritySpecific:
+		return "priority-specific"
+	default:
+		return fmt.Sprintf("CombiningAlgorithm(%d)", int(c))
+	}
+}
+
+// ParseCombiningAlgorithm parses an algorithm name as returned by String.
+// An empty name selects CombinePriority.
+func ParseCombiningAlgorithm(s string) (CombiningAlgorithm, error) {
+	if s == "" {
+		return CombinePriority, nil
+	}
+	for c := CombinePriority; c <= CombinePrioritySpecific; c++ {
+		if strings.EqualFold(s, c.String()) {
+			return c, nil
+		}
+	}
+	return CombinePriority, fmt.Errorf("unknown combining algorithm: %s", s)
+}
+
+// ruleMatch is an entry that matched a request, with the specificity of its
+// pattern as compiled in the rule index
+type ruleMatch struct {
+	entry       *ACLEntry
+	specificity int
+}
+
+// combine decides between the matching entries, which are in ACL order
+func combine(algorithm CombiningAlgorithm, matching []ruleMatch, defaultEffect Effect) Decision {
+	decision := Decision{Allowed: defaultEffect == EffectAllow, Algorithm: algorithm}
+	if len(matching) == 0 {
+		return decision
+	}
+
+	var deciding *ACLEntry
+	switch algorithm {
+	case CombineDenyOverrides:
+		deciding = firstWithEffect(matching, EffectDeny)
+		if deciding == nil {
+			deciding = firstWithEffect(matching, EffectAllow)
+		}
+	case CombinePermitOverrides:
+		deciding = firstWithEffect(matching, EffectAllow)
+		if deciding == nil {
+			deciding = firstWithEffect(matching, EffectDeny)
+		}
+	case CombineFirstApplicable:
+		deciding = matching[0].entry
+	case CombineMostSpecific:
+		deciding = bestEntry(matching, func(a, b ruleMatch) bool {
+			if a.specificity != b.specificity {
+				return a.specificity > b.specificity
+			}
+			return outranks(a.entry, b.entry)
+		})
+	case CombinePrioritySpecific:
+		deciding = bestEntry(matching, func(a, b ruleMatch) bool {
+			if a.entry.Priority != b.entry.Priority {
+				return a.entry.Priority > b.entry.Priority
+			}
+			if a.specificity != b.specificity {
+				return a.specificity > b.specificity
+			}
+			return outranks(a.entry, b.entry)
+		})
+	default:
+		deciding = bestEntry(matching, func(a, b ruleMatch) bool {
+			return outranks(a.entry, b.entry)
+		})
+	}
+
+	if deciding == nil {
+		// Only possible if an entry has an effect other than allow or deny
+		decision.Allowed = false
+		return decision
+	}
+	decision.Allowed = deciding.Effect == EffectAllow
+	decision.RuleID = deciding.ID
+	return decision
+}
+
+// firstWithEffect returns the first entry with the given effect
+func firstWithEffect(matching []ruleMatch, effect Effect) *ACLEntry {
+	for _, m := range matching {
+		if m.entry.Effect == effect {
+			return m.entry
+		}
+	}
+	return nil
+}
+
+// bestEntry returns the first entry that no later entry beats
+func bestEntry(matching []ruleMatch, better func(a, b ruleMatch) bool) *ACLEntry {
+	var best ruleMatch
+	for _, m := range matching {
+		if m.entry.Effect != EffectAllow && m.entry.Effect != EffectDeny {
+			continue
+		}
+		if best.entry == nil || better(m, best) {
+			best = m
+		}
+	}
+	return best.entry
+}
+
+// outranks reports whether a beats b by priority, with deny beating allow on a tie
+func outranks(a, b *ACLEntry) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return a.Effect == EffectDeny && b.Effect == EffectAllow
+}
@@ -0,0 +1,177 @@
+package permfs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCombiningAlgorithms(t *testing.T) {
+	// The same rules, listed in this order, decided by each algorithm
+	entries := []ACLEntry{
+		{ID: "project-deny", Subject: Everyone(), PathPattern: "/projects/acme/**", Permissions: Read, Effect: Deny, Priority: 10},
+		{ID: "public-allow", Subject: Everyone(), PathPattern: "/projects/acme/public/**", Permissions: Read, Effect: Allow, Priority: 5},
+		{ID: "alice-allow", Subject: User("alice"), PathPattern: "/projects/**", Permissions: Read, Effect: Allow, Priority: 20},
+	}
+	alice := &Identity{UserID: "alice"}
+	bob := &Identity{UserID: "bob"}
+
+	tests := []struct {
+		algorithm CombiningAlgorithm
+		identity  *Identity
+		allowed   bool
+		ruleID    string
+	}{
+		{CombinePriority, alice, true, "alice-allow"},
+		{CombinePriority, bob, false, "project-deny"},
+		{CombineDenyOverrides, alice, false, "project-deny"},
+		{CombineDenyOverrides, bob, false, "project-deny"},
+		{CombinePermitOverrides, alice, true, "public-allow"},
+		{CombinePermitOverrides, bob, true, "public-allow"},
+		{CombineFirstApplicable, alice, false, "project-deny"},
+		{CombineFirstApplicable, bob, false, "project-deny"},
+		{CombineMostSpecific, alice, true, "public-allow"},
+		{CombineMostSpecific, bob, true, "public-allow"},
+		{CombinePrioritySpecific, alice, true, "alice-allow"},
+		{CombinePrioritySpecific, bob, false, "project-deny"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm.String()+"/"+tt.identity.UserID, func(t *testing.T) {
+			e := NewEvaluator(ACL{Entries: entries, Default: Deny, Combining: tt.algorithm})
+			decision, err := e.Decide(&EvaluationContext{
+				Identity:  tt.identity,
+				Path:      "/projects/acme/public/readme.md",
+				Operation: OperationRead,
+			})
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if decision.Allowed != tt.allowed || decision.RuleID != tt.ruleID || decision.Algorithm != tt.algorithm {
+				t.Errorf("expected allowed=%v by %q, got %+v", tt.allowed, tt.ruleID, decision)
+			}
+		})
+	}
+}
+
+func TestCombinePrioritySpecificTieBreak(t *testing.T) {
+	// Equal priorities: the more specific allow beats the broader deny without a priority bump
+	acl := ACL{
+		Default:   Deny,
+		Combining: CombinePrioritySpecific,
+		Entries: []ACLEntry{
+			{ID: "acme-deny", Subject: Everyone(), PathPattern: "/projects/acme/**", Permissions: Read, Effect: Deny},
+			{ID: "public-allow", Subject: Everyone(), PathPattern: "/projects/acme/public/**", Permissions: Read, Effect: Allow},
+		},
+	}
+	identity := &Identity{UserID: "bob"}
+	e := NewEvaluator(acl)
+	if !e.CanRead(identity, "/projects/acme/public/logo.png") {
+		t.Error("expected the more specific allow to win")
+	}
+	if e.CanRead(identity, "/projects/acme/private/plan.txt") {
+		t.Error("expected the deny to apply outside the public tree")
+	}
+
+	if conflicts := FindConflictingRules(acl); len(conflicts) != 0 {
+		t.Errorf("specificity settles the tie, expected no conflicts, got %v", conflicts)
+	}
+	acl.Combining = CombinePriority
+	if conflicts := FindConflictingRules(acl); len(conflicts) != 1 {
+		t.Errorf("expected the tie to be reported under priority combining, got %v", conflicts)
+	}
+}
+
+func TestCombiningAlgorithmNames(t *testing.T) {
+	for c := CombinePriority; c <= CombinePrioritySpecific; c++ {
+		parsed, err := ParseCombiningAlgorithm(c.String())
+		if err != nil || parsed != c {
+			t.Errorf("%s: parsed as %v, %v", c, parsed, err)
+		}
+	}
+	if c, err := ParseCombiningAlgorithm(""); err != nil || c != CombinePriority {
+		t.Errorf("empty name should select priority, got %v, %v", c, err)
+	}
+	if _, err := ParseCombiningAlgorithm("majority"); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
+
+func TestCombiningPolicyAndExplain(t *testing.T) {
+	acl := ACL{
+		Default:   Deny,
+		Combining: CombineDenyOverrides,
+		Entries: []ACLEntry{
+			{ID: "all-read", Subject: Everyone(), PathPattern: "/**", Permissions: Read, Effect: Allow, Priority: 100},
+			{ID: "no-secrets", Subject: Everyone(), PathPattern: "/secrets/**", Permissions: Read, Effect: Deny},
+		},
+	}
+
+	for _, format := range []PolicyFormat{PolicyFormatJSON, PolicyFormatYAML, PolicyFormatText} {
+		var buf bytes.Buffer
+		if err := SavePolicy(ExportPolicy(acl, ""), &buf, format); err != nil {
+			t.Fatalf("format %d: SavePolicy failed: %v", format, err)
+		}
+		policy, err := LoadPolicy(&buf, format)
+		if err != nil {
+			t.Fatalf("format %d: LoadPolicy failed: %v", format, err)
+		}
+		imported, err := ImportPolicy(policy)
+		if err != nil {
+			t.Fatalf("format %d: ImportPolicy failed: %v", format, err)
+		}
+		if imported.Combining != CombineDenyOverrides {
+			t.Errorf("format %d: combining algorithm not preserved: %v", format, imported.Combining)
+		}
+	}
+
+	if _, err := ImportPolicy(&PolicyFile{Default: "deny", Combining: "majority"}); err == nil {
+		t.Error("expected an unknown combining algorithm to be rejected")
+	}
+	if policy := ExportPolicy(ACL{Default: Deny}, ""); policy.Combining != "" {
+		t.Errorf("default algorithm should be omitted, got %q", policy.Combining)
+	}
+
+	pfs, err := New(&mockFileSystem{}, Config{ACL: acl})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+	allowed, result := pfs.TestPermission(&Identity{UserID: "alice"}, "/secrets/key.pem", OperationRead)
+	if allowed || result.Algorithm != CombineDenyOverrides || result.RuleID != "no-secrets" {
+		t.Errorf("unexpected test result: %+v", result)
+	}
+	explanation := result.Explain()
+	if !strings.Contains(explanation, "Combining algorithm: deny-overrides") ||
+		!strings.Contains(explanation, "Decided by rule: no-secrets") {
+		t.Errorf("explanation does not report the algorithm and rule:\n%s", explanation)
+	}
+}
+
+func TestCombiningAlgorithmCached(t *testing.T) {
+	acl := ACL{
+		Default:   Deny,
+		Combining: CombineDenyOverrides,
+		Entries: []ACLEntry{
+			{ID: "team", Subject: User("alice"), PathPattern: "/data/**", Permissions: Read, Effect: Allow, Priority: 100},
+			{ID: "no-drafts", Subject: Everyone(), PathPattern: "/data/drafts/**", Permissions: Read, Effect: Deny},
+		},
+	}
+	pfs, err := New(&mockFileSystem{}, Config{
+		ACL:         acl,
+		Performance: PerformanceConfig{CacheEnabled: true, CacheTTL: time.Hour, CacheMaxSize: 100},
+	})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+
+	// The second call is answered from the cache
+	for i := 0; i < 2; i++ {
+		allowed, result := pfs.TestPermission(&Identity{UserID: "alice"}, "/data/drafts/plan.txt", OperationRead)
+		if allowed || result.Algorithm != CombineDenyOverrides || result.RuleID != "no-drafts" {
+			t.Errorf("call %d: expected deny-overrides by no-drafts, got %s by %q", i+1, result.Algorithm, result.RuleID)
+		}
+	}
+	if stats := pfs.evaluator.cache.Stats(); stats.Hits == 0 {
+		t.Errorf("expected the second call to hit the cache, got %+v", stats)
+	}
+}
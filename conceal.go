@@ -0,0 +1,59 @@
+package permfs
+
+import (
+	"context"
+	"io/fs"
+	"os"
+)
+
+// allOperations lists every operation an identity may hold on a path
+var allOperations = []Operation{
+	OperationRead,
+	OperationWrite,
+	OperationExecute,
+	OperationDelete,
+	OperationMetadata,
+	OperationAdmin,
+}
+
+// conceal turns a permission denial on name into an fs.ErrNotExist error when the
+// identity has no rights on name at all and concealment applies, either globally
+// through Config.Enforcement.Conceal or through a matching deny rule with Conceal set.
+// The denial has already been audited by checkPermission. Other errors are returned unchanged.
+func (pfs *PermFS) conceal(ctx context.Context, op, name string, err error) error {
+	if _, ok := asPermissionError(err); !ok {
+		return err
+	}
+
+	identity, idErr := GetIdentity(ctx)
+	if idErr != nil {
+		return err
+	}
+	evalCtx := &EvaluationContext{
+		Identity: identity,
+		Path:     name,
+		Metadata: GetMetadata(ctx),
+		Time:     pfs.clock.Now(),
+	}
+
+	if !pfs.config.Enforcement.Conceal && !pfs.hasConcealingRule(evalCtx) {
+		return err
+	}
+	for _, o := range allOperations {
+		evalCtx.Operation = o
+		if allowed, evalErr := pfs.evaluator.Evaluate(evalCtx); evalErr != nil || allowed {
+			return err
+		}
+	}
+	return &os.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// hasConcealingRule reports whether a deny rule with Conceal set matches the context
+func (pfs *PermFS) hasConcealingRule(ctx *EvaluationContext) bool {
+	for _, entry := range pfs.evaluator.GetMatchingEntries(ctx) {
+		if entry.Conceal && entry.Effect == EffectDeny {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package permfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+func TestPermFSConceal(t *testing.T) {
+	entries := []ACLEntry{
+		{
+			Subject:     Everyone(),
+			PathPattern: "/hr/**",
+			Permissions: All,
+			Effect:      Deny,
+			Priority:    100,
+			Conceal:     true,
+		},
+		{
+			Subject:     User("alice"),
+			PathPattern: "/public/**",
+			Permissions: Metadata,
+			Effect:      Allow,
+			Priority:    100,
+		},
+	}
+	mfs := seedMemFS(t, "/hr/salaries.xlsx", "/public/readme.txt", "/private/plans.txt")
+	ctx := WithUser(context.Background(), "alice")
+
+	t.Run("rule conceals", func(t *testing.T) {
+		var events []*AuditEvent
+		pfs, _ := New(mfs, Config{
+			ACL: ACL{Entries: entries, Default: Deny},
+			Audit: AuditConfig{
+				Enabled: true,
+				Writer:  io.Discard,
+				Handler: func(event *AuditEvent) { events = append(events, event) },
+			},
+		})
+
+		_, err := pfs.Stat(ctx, "/hr/salaries.xlsx")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected fs.ErrNotExist, got %v", err)
+		}
+		if IsPermissionDenied(err) {
+			t.Error("concealed error must not reveal a permission denial")
+		}
+		if len(events) == 0 || events[0].Result != AuditResultDenied {
+			t.Errorf("expected the real denial to be audited, got %v", events)
+		}
+
+		if _, err := pfs.Lstat(ctx, "/hr/salaries.xlsx"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Lstat: expected fs.ErrNotExist, got %v", err)
+		}
+		if _, err := pfs.OpenFile(ctx, "/hr/salaries.xlsx", os.O_RDONLY, 0); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("OpenFile: expected fs.ErrNotExist, got %v", err)
+		}
+		if _, err := pfs.ReadDir(ctx, "/hr"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("ReadDir: expected fs.ErrNotExist, got %v", err)
+		}
+
+		// Paths without a concealing rule still report the denial
+		if _, err := pfs.Stat(ctx, "/private/plans.txt"); !IsPermissionDenied(err) {
+			t.Errorf("expected permission denied, got %v", err)
+		}
+	})
+
+	t.Run("global conceal", func(t *testing.T) {
+		pfs, _ := New(mfs, Config{
+			ACL:         ACL{Entries: entries, Default: Deny},
+			Enforcement: EnforcementConfig{Conceal: true},
+		})
+
+		if _, err := pfs.Stat(ctx, "/private/plans.txt"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected fs.ErrNotExist, got %v", err)
+		}
+
+		// Some right on the path means its existence is already known
+		_, err := pfs.OpenFile(ctx, "/public/readme.txt", os.O_RDONLY, 0)
+		if !IsPermissionDenied(err) {
+			t.Errorf("expected permission denied, got %v", err)
+		}
+	})
+}
@@ -24,7 +24,7 @@ type HourRange struct {
 
 // Evaluate checks if the current time satisfies the condition
 func (tc *TimeCondition) Evaluate(ctx *EvaluationContext) bool {
-	now := time.Now()
+	now := ctx.now()
 	if tc.Timezone != nil {
 		now = now.In(tc.Timezone)
 	}
@@ -67,6 +67,34 @@ func (tc *TimeCondition) String() string {
 	return "TimeCondition"
 }
 
+// CacheSafe reports that the outcome depends only on the time of the request
+func (tc *TimeCondition) CacheSafe() bool {
+	return true
+}
+
+// MetadataKeys returns nil; the condition reads no metadata
+func (tc *TimeCondition) MetadataKeys() []string {
+	return nil
+}
+
+// CacheHint reports that the outcome holds until the next hour boundary, or the
+// next midnight if only days are restricted, in the condition's timezone
+func (tc *TimeCondition) CacheHint(ctx *EvaluationContext) (bool, time.Time) {
+	now := ctx.now()
+	if tc.Timezone != nil {
+		now = now.In(tc.Timezone)
+	}
+
+	switch {
+	case len(tc.AllowedHours) > 0:
+		return true, time.Date(now.Year(), now.Month(), now.Day(), now.Hour()+1, 0, 0, 0, now.Location())
+	case len(tc.AllowedDays) > 0:
+		return true, time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	default:
+		return true, time.Time{}
+	}
+}
+
 // NewBusinessHoursCondition creates a condition for standard business hours (9am-5pm, weekdays)
 func NewBusinessHoursCondition() *TimeCondition {
 	return &TimeCondition{
@@ -130,6 +158,16 @@ func (ic *IPCondition) String() string {
 	return "IPCondition"
 }
 
+// CacheSafe reports that the outcome depends only on the source_ip metadata
+func (ic *IPCondition) CacheSafe() bool {
+	return true
+}
+
+// MetadataKeys returns the metadata key holding the source IP
+func (ic *IPCondition) MetadataKeys() []string {
+	return []string{"source_ip"}
+}
+
 // NewIPCondition creates a new IP condition from CIDR strings
 func NewIPCondition(allowedCIDRs, deniedCIDRs []string) (*IPCondition, error) {
 	cond := &IPCondition{}
@@ -195,6 +233,16 @@ func (mc *MetadataCondition) String() string {
 	return "MetadataCondition:" + mc.Key
 }
 
+// CacheSafe reports that the outcome depends only on the checked metadata key
+func (mc *MetadataCondition) CacheSafe() bool {
+	return true
+}
+
+// MetadataKeys returns the checked metadata key
+func (mc *MetadataCondition) MetadataKeys() []string {
+	return []string{mc.Key}
+}
+
 // CustomConditionFunc is a function type for custom conditions
 type CustomConditionFunc func(ctx *EvaluationContext) bool
 
@@ -242,6 +290,21 @@ func (ac *AndCondition) String() string {
 	return "AndCondition"
 }
 
+// CacheSafe reports whether all sub-conditions are cache-safe
+func (ac *AndCondition) CacheSafe() bool {
+	return conditionsCacheSafe(ac.Conditions)
+}
+
+// MetadataKeys returns the metadata keys read by the sub-conditions
+func (ac *AndCondition) MetadataKeys() []string {
+	return conditionsMetadataKeys(ac.Conditions)
+}
+
+// CacheHint combines the hints of the sub-conditions
+func (ac *AndCondition) CacheHint(ctx *EvaluationContext) (bool, time.Time) {
+	return conditionsCacheHint(ac.Conditions, ctx)
+}
+
 // OrCondition requires at least one sub-condition to be true
 type OrCondition struct {
 	Conditions []Condition
@@ -262,6 +325,21 @@ func (oc *OrCondition) String() string {
 	return "OrCondition"
 }
 
+// CacheSafe reports whether all sub-conditions are cache-safe
+func (oc *OrCondition) CacheSafe() bool {
+	return conditionsCacheSafe(oc.Conditions)
+}
+
+// MetadataKeys returns the metadata keys read by the sub-conditions
+func (oc *OrCondition) MetadataKeys() []string {
+	return conditionsMetadataKeys(oc.Conditions)
+}
+
+// CacheHint combines the hints of the sub-conditions
+func (oc *OrCondition) CacheHint(ctx *EvaluationContext) (bool, time.Time) {
+	return conditionsCacheHint(oc.Conditions, ctx)
+}
+
 // NotCondition inverts a condition
 type NotCondition struct {
 	Condition Condition
@@ -276,3 +354,18 @@ func (nc *NotCondition) Evaluate(ctx *EvaluationContext) bool {
 func (nc *NotCondition) String() string {
 	return "NotCondition"
 }
+
+// CacheSafe reports whether the wrapped condition is cache-safe
+func (nc *NotCondition) CacheSafe() bool {
+	return isCacheSafe(nc.Condition)
+}
+
+// MetadataKeys returns the metadata keys read by the wrapped condition
+func (nc *NotCondition) MetadataKeys() []string {
+	return conditionsMetadataKeys([]Condition{nc.Condition})
+}
+
+// CacheHint returns the hint of the wrapped condition
+func (nc *NotCondition) CacheHint(ctx *EvaluationContext) (bool, time.Time) {
+	return conditionsCacheHint([]Condition{nc.Condition}, ctx)
+}
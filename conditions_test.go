@@ -472,3 +472,32 @@ func TestMetadataConditionString(t *testing.T) {
 		t.Errorf("Expected 'MetadataCondition:test', got %q", s)
 	}
 }
+
+func TestTimeConditionCacheHint(t *testing.T) {
+	kolkata := time.FixedZone("IST", 5*3600+30*60)
+	now := time.Date(2026, 5, 4, 16, 40, 15, 0, time.UTC) // 22:10:15 IST
+	ctx := &EvaluationContext{Time: now}
+
+	tests := []struct {
+		name string
+		cond *TimeCondition
+		want time.Time
+	}{
+		{"hours", &TimeCondition{AllowedHours: []HourRange{{Start: 9, End: 17}}}, time.Date(2026, 5, 4, 17, 0, 0, 0, time.UTC)},
+		{"hours in timezone", &TimeCondition{AllowedHours: []HourRange{{Start: 9, End: 17}}, Timezone: kolkata}, time.Date(2026, 5, 4, 17, 30, 0, 0, time.UTC)},
+		{"days only", &TimeCondition{AllowedDays: []time.Weekday{time.Monday}}, time.Date(2026, 5, 5, 0, 0, 0, 0, time.UTC)},
+		{"unrestricted", &TimeCondition{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		cacheable, until := tt.cond.CacheHint(ctx)
+		if !cacheable || !until.Equal(tt.want) {
+			t.Errorf("%s: got %v %v, want cacheable until %v", tt.name, cacheable, until, tt.want)
+		}
+	}
+
+	// Composites report the earliest bound of their parts
+	and := &AndCondition{Conditions: []Condition{tests[2].cond, &NotCondition{Condition: tests[0].cond}}}
+	if cacheable, until := and.CacheHint(ctx); !cacheable || !until.Equal(tests[0].want) {
+		t.Errorf("AndCondition: got %v %v, want cacheable until %v", cacheable, until, tests[0].want)
+	}
+}
@@ -3,6 +3,7 @@ package permfs
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -17,6 +18,27 @@ var (
 
 	// ErrInvalidConfig is returned when configuration is invalid
 	ErrInvalidConfig = errors.New("invalid configuration")
+
+	// ErrPathEscapesRoot is returned when a path resolves outside the root of an OSFileSystem
+	ErrPathEscapesRoot = errors.New("path escapes filesystem root")
+
+	// ErrRuleNotFound is returned when no ACL entry has the requested ID
+	ErrRuleNotFound = errors.New("rule not found")
+
+	// ErrDuplicateRuleID is returned when a rule ID is already in use
+	ErrDuplicateRuleID = errors.New("duplicate rule ID")
+
+	// ErrUnsupportedCondition is returned when a condition cannot be written to a policy file
+	ErrUnsupportedCondition = errors.New("unsupported condition")
+)
+
+// Errors reported inside *os.PathError by the bundled FileSystem implementations
+var (
+	errIsDirectory         = errors.New("is a directory")
+	errNotDirectory        = errors.New("not a directory")
+	errDirectoryNotEmpty   = errors.New("directory not empty")
+	errWriteAtInAppendMode = errors.New("WriteAt in O_APPEND mode")
+	errTooManyLinks        = errors.New("too many levels of symbolic links")
 )
 
 // PermissionError represents a permission denial with additional context
@@ -29,6 +51,8 @@ type PermissionError struct {
 	UserID string
 	// Reason provides additional context for the denial
 	Reason string
+	// RuleID is the ID of the ACL entry that denied access, if it has one
+	RuleID string
 }
 
 // Error implements the error interface
@@ -60,3 +84,37 @@ func NewPermissionError(path string, op Operation, userID string, reason string)
 		Reason:    reason,
 	}
 }
+
+// MultiPathError reports every path for which part of a recursive operation was denied
+type MultiPathError struct {
+	// Op is the filesystem operation that was attempted (e.g. "removeall")
+	Op string
+	// Path is the root path the operation was invoked on
+	Path string
+	// Denied contains one permission error per refused path
+	Denied []*PermissionError
+}
+
+// Error implements the error interface
+func (e *MultiPathError) Error() string {
+	paths := e.DeniedPaths()
+	if len(paths) > 3 {
+		paths = append(paths[:3], fmt.Sprintf("and %d more", len(e.Denied)-3))
+	}
+	return fmt.Sprintf("permission denied: %s %s: %d path(s) refused: %s",
+		e.Op, e.Path, len(e.Denied), strings.Join(paths, ", "))
+}
+
+// Unwrap returns the underlying error
+func (e *MultiPathError) Unwrap() error {
+	return ErrPermissionDenied
+}
+
+// DeniedPaths returns the refused paths in the order they were encountered
+func (e *MultiPathError) DeniedPaths() []string {
+	paths := make([]string, len(e.Denied))
+	for i, denied := range e.Denied {
+		paths[i] = denied.Path
+	}
+	return paths
+}
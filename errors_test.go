@@ -79,3 +79,24 @@ func TestErrors(t *testing.T) {
 	})
 
 }
+
+func TestMultiPathError(t *testing.T) {
+	err := &MultiPathError{Op: "removeall", Path: "/projects"}
+	for _, p := range []string{"/projects/a", "/projects/b", "/projects/c", "/projects/d"} {
+		err.Denied = append(err.Denied, NewPermissionError(p, OperationDelete, "alice", "denied").(*PermissionError))
+	}
+
+	if !IsPermissionDenied(err) {
+		t.Error("MultiPathError should be a permission denial")
+	}
+
+	paths := err.DeniedPaths()
+	if len(paths) != 4 || paths[0] != "/projects/a" || paths[3] != "/projects/d" {
+		t.Errorf("unexpected denied paths: %v", paths)
+	}
+
+	msg := err.Error()
+	if !containsString(msg, "4 path(s)") || !containsString(msg, "and 1 more") {
+		t.Errorf("unexpected error message: %s", msg)
+	}
+}
@@ -1,135 +1,245 @@
 package permfs
 
 import (
-	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// Evaluator evaluates permissions based on ACL rules
+// Evaluator evaluates permissions based on ACL rules.
+// The ACL is held as an immutable snapshot that is replaced atomically on every
+// update, so evaluations never observe a partially applied change. Each snapshot
+// is compiled into an index so that a request only examines the entries that
+// can apply to its subject and path.
 type Evaluator struct {
-	acl          ACL
+	state        atomic.Pointer[evaluatorState]
+	updateMu     sync.Mutex // serializes UpdateACL
 	cache        *PermissionCache
 	patternCache *PatternCache
+	clock        Clock
+}
+
+// evaluatorState is an ACL snapshot together with the index compiled from it
+type evaluatorState struct {
+	acl   *ACL
+	index *ruleIndex
 }
 
 // NewEvaluator creates a new permission evaluator
 func NewEvaluator(acl ACL) *Evaluator {
-	return &Evaluator{
-		acl:          acl,
+	e := &Evaluator{
 		cache:        nil, // Cache is optional
 		patternCache: nil, // Pattern cache is optional
+		clock:        SystemClock,
 	}
+	e.store(acl.clone())
+	return e
 }
 
 // NewEvaluatorWithCache creates a new evaluator with caching enabled
 func NewEvaluatorWithCache(acl ACL, cache *PermissionCache, patternCache *PatternCache) *Evaluator {
-	return &Evaluator{
-		acl:          acl,
+	e := &Evaluator{
 		cache:        cache,
 		patternCache: patternCache,
+		clock:        SystemClock,
+	}
+	e.store(acl.clone())
+	return e
+}
+
+// store compiles acl and makes it the current snapshot
+func (e *Evaluator) store(acl *ACL) {
+	e.state.Store(&evaluatorState{acl: acl, index: newRuleIndex(acl, e.patternCache)})
+}
+
+// clone returns a copy of the ACL whose entry slice can be modified independently
+func (a ACL) clone() *ACL {
+	entries := make([]ACLEntry, len(a.Entries))
+	copy(entries, a.Entries)
+	return &ACL{Entries: entries, Default: a.Default, Combining: a.Combining}
+}
+
+// indexOf returns the index of the entry with the given ID, or -1
+func (a *ACL) indexOf(id string) int {
+	for i, entry := range a.Entries {
+		if entry.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// snapshot returns the current ACL. It must not be modified.
+func (e *Evaluator) snapshot() *ACL {
+	return e.state.Load().acl
+}
+
+// ACL returns a copy of the current ACL
+func (e *Evaluator) ACL() ACL {
+	return *e.snapshot().clone()
+}
+
+// UpdateACL applies fn to a copy of the current ACL and, if fn succeeds, makes the
+// result visible to all subsequent evaluations at once and clears the cache.
+// Updates are serialized; if fn returns an error the ACL is left unchanged.
+func (e *Evaluator) UpdateACL(fn func(*ACL) error) error {
+	e.updateMu.Lock()
+	defer e.updateMu.Unlock()
+
+	next := e.snapshot().clone()
+	if err := fn(next); err != nil {
+		return err
 	}
+	e.store(next)
+	e.ClearCache()
+	return nil
+}
+
+// Decision is the outcome of a permission evaluation
+type Decision struct {
+	// Allowed reports whether the operation is permitted
+	Allowed bool
+	// RuleID is the ID of the entry that decided the outcome. It is empty when
+	// the default effect applied or the deciding entry has no ID.
+	RuleID string
+	// Algorithm is the combining algorithm that produced the decision
+	Algorithm CombiningAlgorithm
+	// ValidUntil is when a relevant rule's validity window next opens or closes,
+	// or a consulted condition's outcome may change, after which the decision
+	// may differ. Zero means no such bound.
+	ValidUntil time.Time
+
+	// uncacheable is set when a condition that is not cache-safe took part
+	uncacheable bool
 }
 
 // Evaluate checks if the given operation is allowed for the context
 func (e *Evaluator) Evaluate(ctx *EvaluationContext) (bool, error) {
-	// Check cache first if enabled
+	decision, err := e.Decide(ctx)
+	return decision.Allowed, err
+}
+
+// Decide evaluates the context and reports which rule decided the outcome
+func (e *Evaluator) Decide(ctx *EvaluationContext) (Decision, error) {
+	state := e.state.Load()
+
+	// Check cache first if enabled. A hit must stay cheap: the key is built
+	// without allocating and the context is only copied on a miss.
 	if e.cache != nil && ctx.Identity != nil {
 		cacheKey := CacheKey{
-			UserID:    ctx.Identity.UserID,
-			Path:      ctx.Path,
-			Operation: ctx.Operation,
+			UserID:      ctx.Identity.UserID,
+			Path:        ctx.Path,
+			Operation:   ctx.Operation,
+			Fingerprint: requestFingerprint(ctx.Identity, ctx.Metadata, state.index.metadataKeys),
 		}
-		if allowed, found := e.cache.Get(cacheKey); found {
-			return allowed, nil
+		if decision, found := e.cache.GetDecision(cacheKey); found {
+			return decision, nil
 		}
 
 		// Evaluate and cache the result
-		allowed, err := e.evaluateUncached(ctx)
-		if err == nil {
-			e.cache.Set(cacheKey, allowed)
+		decision, err := e.evaluateUncached(state, e.fixTime(ctx))
+		if err == nil && !decision.uncacheable {
+			e.cache.SetDecision(cacheKey, decision)
+			// An update may have cleared the cache while this result was computed
+			// from the previous snapshot; do not let it outlive that snapshot
+			if e.state.Load() != state {
+				e.cache.Delete(cacheKey)
+			}
 		}
-		return allowed, err
+		return decision, err
 	}
 
 	// No cache, evaluate directly
-	return e.evaluateUncached(ctx)
+	return e.evaluateUncached(state, e.fixTime(ctx))
 }
 
-// evaluateUncached performs the actual permission evaluation without caching
-func (e *Evaluator) evaluateUncached(ctx *EvaluationContext) (bool, error) {
-	// Find all matching entries
-	var matchingEntries []ACLEntry
-	for _, entry := range e.acl.Entries {
-		if entry.Matches(ctx) && entry.Applies(ctx.Operation) {
-			matchingEntries = append(matchingEntries, entry)
-		}
-	}
-
-	// If no entries match, use default policy
-	if len(matchingEntries) == 0 {
-		return e.acl.Default == EffectAllow, nil
+// fixTime returns ctx with its time set from the evaluator's clock if it has
+// none, so every rule and condition sees the same instant
+func (e *Evaluator) fixTime(ctx *EvaluationContext) *EvaluationContext {
+	if !ctx.Time.IsZero() {
+		return ctx
 	}
+	timed := *ctx
+	timed.Time = e.clock.Now()
+	return &timed
+}
 
-	// Sort by priority (higher priority first)
-	sort.Slice(matchingEntries, func(i, j int) bool {
-		return matchingEntries[i].Priority > matchingEntries[j].Priority
-	})
-
-	// Evaluation order:
-	// 1. Explicit deny rules (highest priority)
-	// 2. Explicit allow rules
-	// 3. Default deny
-
-	// First pass: check for explicit deny at highest priority level
-	highestPriority := matchingEntries[0].Priority
-	for _, entry := range matchingEntries {
-		// Only consider entries at the highest priority level
-		if entry.Priority < highestPriority {
-			break
-		}
-		if entry.Effect == EffectDeny {
-			return false, nil
-		}
-	}
+// evaluateUncached performs the actual permission evaluation without caching
+func (e *Evaluator) evaluateUncached(state *evaluatorState, ctx *EvaluationContext) (Decision, error) {
+	acl, index := state.acl, state.index
+	now := ctx.now()
+	cleanPath := normalizePatternPath(ctx.Path)
 
-	// Second pass: check for explicit allow at highest priority level
-	for _, entry := range matchingEntries {
-		// Only consider entries at the highest priority level
-		if entry.Priority < highestPriority {
-			break
+	// Find all matching entries, noting when an inactive or expiring one changes state.
+	// The index narrows the scan to entries for this subject and path, in ACL order.
+	var matchingEntries []ruleMatch
+	var validUntil time.Time
+	uncacheable := false
+	for _, i := range index.candidates(ctx.Identity, cleanPath) {
+		entry := &acl.Entries[i]
+		if !entry.Applies(ctx.Operation) || !index.patterns[i].matchClean(cleanPath) {
+			continue
 		}
-		if entry.Effect == EffectAllow {
-			return true, nil
+		if !index.cacheSafe[i] {
+			uncacheable = true
+		} else if len(entry.Conditions) > 0 {
+			cacheable, until := conditionsCacheHint(entry.Conditions, ctx)
+			uncacheable = uncacheable || !cacheable
+			validUntil = earliest(validUntil, until)
 		}
-	}
-
-	// If we get here, check next priority level
-	// This handles the case where multiple priority levels exist
-	for _, entry := range matchingEntries {
-		if entry.Effect == EffectDeny {
-			return false, nil
+		if !entry.conditionsHold(ctx) {
+			continue
 		}
-		if entry.Effect == EffectAllow {
-			return true, nil
+		validUntil = earliest(validUntil, entry.nextTransition(now))
+		if entry.ActiveAt(now) {
+			matchingEntries = append(matchingEntries, ruleMatch{entry: entry, specificity: index.patterns[i].specificity})
 		}
 	}
 
-	// Default to deny if no explicit allow
-	return false, nil
+	decision := combine(acl.Combining, matchingEntries, acl.Default)
+	decision.ValidUntil = validUntil
+	decision.uncacheable = uncacheable
+	return decision, nil
 }
 
 // GetMatchingEntries returns all ACL entries that match the given context
 func (e *Evaluator) GetMatchingEntries(ctx *EvaluationContext) []ACLEntry {
+	state := e.state.Load()
+	ctx = e.fixTime(ctx)
+	now := ctx.now()
+	cleanPath := normalizePatternPath(ctx.Path)
+
 	var matching []ACLEntry
-	for _, entry := range e.acl.Entries {
-		if entry.Matches(ctx) {
+	for _, i := range state.index.candidates(ctx.Identity, cleanPath) {
+		entry := state.acl.Entries[i]
+		if entry.ActiveAt(now) && state.index.patterns[i].matchClean(cleanPath) && entry.conditionsHold(ctx) {
 			matching = append(matching, entry)
 		}
 	}
 	return matching
 }
 
+// entriesForPath returns the entries whose pattern matches path, for any subject
+func (e *Evaluator) entriesForPath(path string) []ACLEntry {
+	state := e.state.Load()
+	cleanPath := normalizePatternPath(path)
+
+	var entries []ACLEntry
+	for i, pattern := range state.index.patterns {
+		if pattern.matchClean(cleanPath) {
+			entries = append(entries, state.acl.Entries[i])
+		}
+	}
+	return entries
+}
+
 // GetEffectivePermissions returns the effective permissions for a path and identity
 func (e *Evaluator) GetEffectivePermissions(identity *Identity, path string) Operation {
+	return e.effectivePermissions(EvaluationContext{Identity: identity, Path: path})
+}
+
+// effectivePermissions returns the operations allowed in ctx, whatever its Operation
+func (e *Evaluator) effectivePermissions(ctx EvaluationContext) Operation {
 	var allowed Operation
 
 	// Check each operation type
@@ -143,13 +253,8 @@ func (e *Evaluator) GetEffectivePermissions(identity *Identity, path string) Ope
 	}
 
 	for _, op := range operations {
-		ctx := &EvaluationContext{
-			Identity:  identity,
-			Path:      path,
-			Operation: op,
-		}
-
-		if ok, _ := e.Evaluate(ctx); ok {
+		ctx.Operation = op
+		if ok, _ := e.Evaluate(&ctx); ok {
 			allowed |= op
 		}
 	}
@@ -237,11 +342,21 @@ func (e *Evaluator) InvalidateCache(userID string, pathPrefix string) {
 	}
 }
 
-// GetCacheStats returns cache statistics
+// GetCacheStats returns cache statistics, or nil if neither cache is enabled
 func (e *Evaluator) GetCacheStats() *CacheStats {
+	if e.cache == nil && e.patternCache == nil {
+		return nil
+	}
+
+	var stats CacheStats
 	if e.cache != nil {
-		stats := e.cache.Stats()
-		return &stats
+		stats = e.cache.Stats()
 	}
-	return nil
+	if e.patternCache != nil {
+		patternStats := e.patternCache.Stats()
+		stats.PatternCacheSize = patternStats.Size
+		stats.PatternHits = patternStats.Hits
+		stats.PatternMisses = patternStats.Misses
+	}
+	return &stats
 }
@@ -0,0 +1,143 @@
+package permfs
+
+import (
+	"sort"
+	"strings"
+)
+
+// ruleIndex is a compiled form of an ACL snapshot. Entries are grouped by
+// subject, and within each subject by the literal leading segments of their
+// path pattern in a segment trie, so a request only examines the entries that
+// can possibly match it. Patterns are compiled once per snapshot.
+type ruleIndex struct {
+	patterns []*PatternMatcher // parallel to the ACL's entries
+	users    map[string]*segmentTrie
+	groups   map[string]*segmentTrie
+	roles    map[string]*segmentTrie
+	everyone *segmentTrie
+	// cacheSafe records, per entry, whether all of its conditions are cache-safe
+	cacheSafe []bool
+	// metadataKeys lists, sorted, the metadata keys read by cache-safe conditions
+	metadataKeys []string
+}
+
+// segmentTrie maps literal path segments to the entries whose pattern begins with them
+type segmentTrie struct {
+	entries  []int // indexes into ACL.Entries, ascending
+	children map[string]*segmentTrie
+}
+
+// newRuleIndex compiles the entries of acl, reusing matchers from patterns if it is not nil
+func newRuleIndex(acl *ACL, patterns *PatternCache) *ruleIndex {
+	idx := &ruleIndex{
+		patterns:  make([]*PatternMatcher, len(acl.Entries)),
+		users:     make(map[string]*segmentTrie),
+		groups:    make(map[string]*segmentTrie),
+		roles:     make(map[string]*segmentTrie),
+		everyone:  &segmentTrie{},
+		cacheSafe: make([]bool, len(acl.Entries)),
+	}
+
+	metadataKeys := make(map[string]bool)
+	for i, entry := range acl.Entries {
+		idx.patterns[i] = patterns.compile(entry.PathPattern)
+		idx.cacheSafe[i] = conditionsCacheSafe(entry.Conditions)
+		for _, key := range conditionsMetadataKeys(entry.Conditions) {
+			metadataKeys[key] = true
+		}
+
+		var trie *segmentTrie
+		switch entry.Subject.Type {
+		case SubjectTypeUser:
+			trie = subjectTrie(idx.users, entry.Subject.ID)
+		case SubjectTypeGroup:
+			trie = subjectTrie(idx.groups, entry.Subject.ID)
+		case SubjectTypeRole:
+			trie = subjectTrie(idx.roles, entry.Subject.ID)
+		case SubjectTypeEveryone:
+			trie = idx.everyone
+		default:
+			// Identity.Matches never matches an unknown subject type
+			continue
+		}
+		trie.insert(idx.patterns[i].prefix, i)
+	}
+
+	for key := range metadataKeys {
+		idx.metadataKeys = append(idx.metadataKeys, key)
+	}
+	sort.Strings(idx.metadataKeys)
+	return idx
+}
+
+func subjectTrie(tries map[string]*segmentTrie, id string) *segmentTrie {
+	trie, ok := tries[id]
+	if !ok {
+		trie = &segmentTrie{}
+		tries[id] = trie
+	}
+	return trie
+}
+
+func (t *segmentTrie) insert(prefix []string, entry int) {
+	node := t
+	for _, segment := range prefix {
+		child, ok := node.children[segment]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[string]*segmentTrie)
+			}
+			child = &segmentTrie{}
+			node.children[segment] = child
+		}
+		node = child
+	}
+	node.entries = append(node.entries, entry)
+}
+
+// collect appends the entries stored along the path given by segments
+func (t *segmentTrie) collect(segments []string, dst []int) []int {
+	node := t
+	dst = append(dst, node.entries...)
+	for _, segment := range segments {
+		node = node.children[segment]
+		if node == nil {
+			break
+		}
+		dst = append(dst, node.entries...)
+	}
+	return dst
+}
+
+// candidates returns, in ACL order, the entries whose subject matches identity
+// and whose literal pattern prefix is a prefix of cleanPath
+func (idx *ruleIndex) candidates(identity *Identity, cleanPath string) []int {
+	segments := strings.Split(cleanPath, "/")
+
+	result := idx.everyone.collect(segments, nil)
+	if identity != nil {
+		if trie := idx.users[identity.UserID]; trie != nil {
+			result = trie.collect(segments, result)
+		}
+		for _, group := range identity.Groups {
+			if trie := idx.groups[group]; trie != nil {
+				result = trie.collect(segments, result)
+			}
+		}
+		for _, role := range identity.Roles {
+			if trie := idx.roles[role]; trie != nil {
+				result = trie.collect(segments, result)
+			}
+		}
+	}
+
+	sort.Ints(result)
+	// A repeated group or role would contribute its entries twice
+	unique := result[:0]
+	for i, entry := range result {
+		if i == 0 || entry != result[i-1] {
+			unique = append(unique, entry)
+		}
+	}
+	return unique
+}
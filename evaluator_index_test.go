@@ -0,0 +1,215 @@
+package permfs
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// linearDecide is the unindexed evaluator: every entry is matched against the
+// request with matchPattern, then the matches are combined
+func linearDecide(acl ACL, ctx *EvaluationContext) Decision {
+	now := ctx.now()
+	var matching []ruleMatch
+	var validUntil time.Time
+	uncacheable := false
+	for i := range acl.Entries {
+		entry := &acl.Entries[i]
+		if !entry.Applies(ctx.Operation) {
+			continue
+		}
+		if matched, _ := matchPattern(entry.PathPattern, ctx.Path); matched && ctx.Identity.Matches(entry.Subject) {
+			if !conditionsCacheSafe(entry.Conditions) {
+				uncacheable = true
+			} else {
+				cacheable, until := conditionsCacheHint(entry.Conditions, ctx)
+				uncacheable = uncacheable || !cacheable
+				validUntil = earliest(validUntil, until)
+			}
+		}
+		if !entry.matchesRequest(ctx) {
+			continue
+		}
+		validUntil = earliest(validUntil, entry.nextTransition(now))
+		if entry.ActiveAt(now) {
+			matching = append(matching, ruleMatch{entry: entry, specificity: PatternSpecificity(entry.PathPattern)})
+		}
+	}
+	decision := combine(acl.Combining, matching, acl.Default)
+	decision.ValidUntil = validUntil
+	decision.uncacheable = uncacheable
+	return decision
+}
+
+func TestIndexedEvaluatorMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(21))
+
+	users := []string{"alice", "bob", "carol"}
+	groups := []string{"eng", "ops", "sales"}
+	roles := []string{"admin", "auditor"}
+	patternSegments := []string{"a", "b", "data", "*", "**", "?", "x*", "[ab]", "*.txt", ".", "..", "[", `x\1`}
+	pathSegments := []string{"a", "b", "data", "x1", "xy", "c", "f.txt", "..", ".", "["}
+	operations := []Operation{OperationRead, OperationWrite, OperationDelete, OperationAdmin}
+	now := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+
+	randomPath := func(segments []string, maxLen int) string {
+		parts := make([]string, 1+rng.Intn(maxLen))
+		for i := range parts {
+			parts[i] = segments[rng.Intn(len(segments))]
+		}
+		p := strings.Join(parts, "/")
+		switch rng.Intn(6) {
+		case 0: // relative
+		case 1:
+			p = "/" + p + "/"
+		default:
+			p = "/" + p
+		}
+		return p
+	}
+	randomSubject := func() Subject {
+		switch rng.Intn(5) {
+		case 0:
+			return Everyone()
+		case 1, 2:
+			return User(users[rng.Intn(len(users))])
+		case 3:
+			return Group(groups[rng.Intn(len(groups))])
+		default:
+			return Role(roles[rng.Intn(len(roles))])
+		}
+	}
+	randomWindow := func() time.Time {
+		if rng.Intn(4) != 0 {
+			return time.Time{}
+		}
+		return now.Add(time.Duration(rng.Intn(5)-2) * time.Hour)
+	}
+	randomIdentity := func() *Identity {
+		identity := &Identity{UserID: users[rng.Intn(len(users))]}
+		for _, g := range groups {
+			if rng.Intn(2) == 0 {
+				identity.Groups = append(identity.Groups, g)
+			}
+		}
+		if len(identity.Groups) > 0 && rng.Intn(4) == 0 {
+			identity.Groups = append(identity.Groups, identity.Groups[0])
+		}
+		for _, r := range roles {
+			if rng.Intn(3) == 0 {
+				identity.Roles = append(identity.Roles, r)
+			}
+		}
+		return identity
+	}
+
+	for round := 0; round < 300; round++ {
+		acl := ACL{
+			Default:   Effect(rng.Intn(2)),
+			Combining: CombiningAlgorithm(rng.Intn(int(CombinePrioritySpecific) + 1)),
+		}
+		for i, n := 0, rng.Intn(40); i < n; i++ {
+			entry := ACLEntry{
+				ID:          fmt.Sprintf("r%d", i),
+				Subject:     randomSubject(),
+				PathPattern: randomPath(patternSegments, 4),
+				Permissions: Operation(1 + rng.Intn(int(All))),
+				Effect:      Effect(rng.Intn(2)),
+				Priority:    rng.Intn(3),
+				NotBefore:   randomWindow(),
+				NotAfter:    randomWindow(),
+			}
+			switch rng.Intn(12) {
+			case 0:
+				entry.Conditions = []Condition{&MetadataCondition{Key: "env", Values: []string{"prod"}}}
+			case 1:
+				entry.Conditions = []Condition{&NotCondition{Condition: NewBusinessHoursCondition()}}
+			case 2:
+				entry.Conditions = []Condition{NewFuncCondition("even", func(ctx *EvaluationContext) bool {
+					return len(ctx.Path)%2 == 0
+				})}
+			}
+			acl.Entries = append(acl.Entries, entry)
+		}
+		e := NewEvaluator(acl)
+
+		for q := 0; q < 50; q++ {
+			ctx := &EvaluationContext{
+				Identity:  randomIdentity(),
+				Path:      randomPath(pathSegments, 5),
+				Operation: operations[rng.Intn(len(operations))],
+				Time:      now,
+			}
+			if rng.Intn(2) == 0 {
+				ctx.Metadata = map[string]interface{}{"env": "prod"}
+			}
+
+			got, err := e.Decide(ctx)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+			if want := linearDecide(acl, ctx); !reflect.DeepEqual(got, want) {
+				t.Fatalf("round %d: %+v on %q by %+v\nindexed: %+v\nlinear:  %+v\nacl: %v",
+					round, ctx.Operation, ctx.Path, ctx.Identity, got, want, acl.Entries)
+			}
+		}
+	}
+}
+
+func TestRuleIndexCandidates(t *testing.T) {
+	acl := ACL{Entries: []ACLEntry{
+		{Subject: Everyone(), PathPattern: "/**"},
+		{Subject: User("alice"), PathPattern: "/home/alice/**"},
+		{Subject: Group("eng"), PathPattern: "/projects/*/src"},
+		{Subject: Role("admin"), PathPattern: "/projects/acme/README"},
+		{Subject: User("bob"), PathPattern: "/home/bob/**"},
+		{Subject: Group("eng"), PathPattern: "/projects/acme/"},
+		{Subject: Group("eng"), PathPattern: "projects/acme"},
+	}}
+	idx := newRuleIndex(&acl, nil)
+
+	tests := []struct {
+		identity *Identity
+		path     string
+		want     []int
+	}{
+		{nil, "/home/alice/notes", []int{0}},
+		{&Identity{UserID: "alice"}, "/home/alice/notes", []int{0, 1}},
+		{&Identity{UserID: "alice"}, "/home/bob/notes", []int{0}},
+		{&Identity{UserID: "carol", Groups: []string{"eng", "eng"}, Roles: []string{"admin"}}, "/projects/acme/README", []int{0, 2, 3, 5}},
+		{&Identity{UserID: "carol", Groups: []string{"eng"}}, "/projects/acme", []int{0, 2, 5}},
+		{&Identity{UserID: "carol", Groups: []string{"eng"}}, "projects/acme/", []int{6}},
+	}
+	for _, tt := range tests {
+		if got := idx.candidates(tt.identity, normalizePatternPath(tt.path)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("candidates(%+v, %q) = %v, want %v", tt.identity, tt.path, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkEvaluateLargeACL(b *testing.B) {
+	var entries []ACLEntry
+	for i := 0; i < 5000; i++ {
+		entries = append(entries, ACLEntry{
+			Subject:     User(fmt.Sprintf("user%d", i%500)),
+			PathPattern: fmt.Sprintf("/home/user%d/project%d/**", i%500, i),
+			Permissions: ReadWrite,
+			Effect:      Allow,
+		})
+	}
+	entries = append(entries, ACLEntry{Subject: Everyone(), PathPattern: "/**/.ssh/**", Permissions: All, Effect: Deny, Priority: 10})
+	e := NewEvaluator(ACL{Entries: entries, Default: Deny})
+	ctx := &EvaluationContext{
+		Identity:  &Identity{UserID: "user42", Groups: []string{"eng"}},
+		Path:      "/home/user42/project42/src/main.go",
+		Operation: OperationRead,
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Evaluate(ctx)
+	}
+}
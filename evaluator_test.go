@@ -1,6 +1,9 @@
 package permfs
 
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 )
@@ -699,6 +702,23 @@ func TestEvaluatorGetCacheStats(t *testing.T) {
 	if stats == nil {
 		t.Error("Expected non-nil stats when cache exists")
 	}
+
+	// Rebuilding the rule index after an update reuses the compiled patterns
+	patternEvaluator := NewEvaluatorWithCache(ACL{
+		Entries: []ACLEntry{{Subject: Everyone(), PathPattern: "/data/**", Permissions: Read, Effect: Allow}},
+		Default: Deny,
+	}, nil, NewPatternCache())
+	err := patternEvaluator.UpdateACL(func(acl *ACL) error {
+		acl.Entries = append(acl.Entries, ACLEntry{Subject: Everyone(), PathPattern: "/tmp/*", Permissions: Write, Effect: Allow})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateACL failed: %v", err)
+	}
+	stats = patternEvaluator.GetCacheStats()
+	if stats == nil || stats.PatternCacheSize != 2 || stats.PatternHits != 1 || stats.PatternMisses != 2 {
+		t.Errorf("Expected 2 cached patterns, 1 hit and 2 misses, got %+v", stats)
+	}
 }
 
 func TestEvaluatorClearCacheNoCache(t *testing.T) {
@@ -775,3 +795,96 @@ func BenchmarkEvaluate(b *testing.B) {
 		_, _ = evaluator.Evaluate(ctx)
 	}
 }
+
+func TestEvaluatorUpdateACL(t *testing.T) {
+	entries := []ACLEntry{
+		{
+			Subject:     User("alice"),
+			PathPattern: "/data/**",
+			Permissions: Read,
+			Effect:      Allow,
+			Priority:    100,
+		},
+	}
+	evaluator := NewEvaluatorWithCache(ACL{Entries: entries, Default: Deny}, NewPermissionCache(100, time.Minute), nil)
+	alice := &Identity{UserID: "alice"}
+
+	if !evaluator.CanRead(alice, "/data/file.txt") || evaluator.CanWrite(alice, "/data/file.txt") {
+		t.Fatal("unexpected initial permissions")
+	}
+
+	// A failing update leaves the ACL untouched
+	errBoom := errors.New("boom")
+	err := evaluator.UpdateACL(func(acl *ACL) error {
+		acl.Entries = nil
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected update error, got %v", err)
+	}
+	if !evaluator.CanRead(alice, "/data/file.txt") {
+		t.Error("failed update must not change the ACL")
+	}
+
+	// A batch becomes visible at once and invalidates cached results
+	err = evaluator.UpdateACL(func(acl *ACL) error {
+		acl.Entries[0].Permissions = ReadWrite
+		acl.Default = Allow
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateACL failed: %v", err)
+	}
+	if !evaluator.CanWrite(alice, "/data/file.txt") {
+		t.Error("expected cached denial to be invalidated")
+	}
+	if !evaluator.CanRead(alice, "/elsewhere") {
+		t.Error("expected new default to apply")
+	}
+
+	// Updates never write through to the caller's slice
+	if entries[0].Permissions != Read {
+		t.Error("UpdateACL modified the ACL passed to NewEvaluator")
+	}
+	if got := evaluator.ACL(); len(got.Entries) != 1 || got.Default != Allow {
+		t.Errorf("unexpected ACL snapshot: %+v", got)
+	}
+}
+
+func TestEvaluatorConcurrentUpdates(t *testing.T) {
+	evaluator := NewEvaluatorWithCache(ACL{Default: Deny}, NewPermissionCache(100, time.Minute), nil)
+	alice := &Identity{UserID: "alice"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				evaluator.UpdateACL(func(acl *ACL) error {
+					acl.Entries = append(acl.Entries, ACLEntry{
+						Subject:     User("alice"),
+						PathPattern: fmt.Sprintf("/w%d/%d", i, j),
+						Permissions: Read,
+						Effect:      Allow,
+					})
+					return nil
+				})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				evaluator.CanRead(alice, "/w0/0")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(evaluator.ACL().Entries); got != 200 {
+		t.Errorf("expected 200 entries after concurrent updates, got %d", got)
+	}
+	if !evaluator.CanRead(alice, "/w0/0") {
+		t.Error("expected final ACL to allow /w0/0")
+	}
+}
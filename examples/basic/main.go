@@ -5,16 +5,21 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"time"
+	"path"
 
 	"github.com/absfs/permfs"
 )
 
 // This example demonstrates basic usage of permfs with a simple ACL
 func main() {
-	// Create a base filesystem (using mock for demonstration)
+	// Create an in-memory base filesystem with some sample files
 	// In a real application, you would use osfs.New("/data") or another filesystem
-	base := &mockFS{}
+	base := newExampleFS(
+		"/home/bob/document.txt",
+		"/home/alice/secret.txt",
+		"/public/readme.txt",
+		"/shared/data.txt",
+	)
 
 	// Configure the ACL
 	config := permfs.Config{
@@ -154,68 +159,19 @@ func main() {
 	}
 }
 
-// mockFS is a simple mock filesystem for demonstration
-type mockFS struct{}
-
-func (m *mockFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (permfs.File, error) {
-	return &mockFile{name: name}, nil
-}
-
-func (m *mockFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
-	return nil
-}
-
-func (m *mockFS) MkdirAll(ctx context.Context, name string, perm os.FileMode) error {
-	return nil
-}
-
-func (m *mockFS) Remove(ctx context.Context, name string) error {
-	return nil
-}
-
-func (m *mockFS) RemoveAll(ctx context.Context, name string) error {
-	return nil
-}
-
-func (m *mockFS) Rename(ctx context.Context, oldname, newname string) error {
-	return nil
-}
-
-func (m *mockFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
-	return nil, nil
-}
-
-func (m *mockFS) Lstat(ctx context.Context, name string) (os.FileInfo, error) {
-	return nil, nil
-}
-
-func (m *mockFS) ReadDir(ctx context.Context, name string) ([]os.FileInfo, error) {
-	return nil, nil
-}
-
-func (m *mockFS) Chmod(ctx context.Context, name string, mode os.FileMode) error {
-	return nil
-}
-
-func (m *mockFS) Chown(ctx context.Context, name string, uid, gid int) error {
-	return nil
-}
-
-func (m *mockFS) Chtimes(ctx context.Context, name string, atime, mtime time.Time) error {
-	return nil
-}
-
-// mockFile implements permfs.File
-type mockFile struct {
-	name string
+// newExampleFS creates an in-memory filesystem pre-populated with empty files
+func newExampleFS(files ...string) *permfs.MemFS {
+	ctx := context.Background()
+	base := permfs.NewMemFS()
+	for _, name := range files {
+		if err := base.MkdirAll(ctx, path.Dir(name), 0755); err != nil {
+			log.Fatal(err)
+		}
+		f, err := base.OpenFile(ctx, name, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f.Close()
+	}
+	return base
 }
-
-func (f *mockFile) Close() error                             { return nil }
-func (f *mockFile) Read(p []byte) (n int, err error)         { return 0, nil }
-func (f *mockFile) Stat() (os.FileInfo, error)               { return nil, nil }
-func (f *mockFile) Write(p []byte) (n int, err error)        { return len(p), nil }
-func (f *mockFile) WriteAt(p []byte, off int64) (n int, err error) { return len(p), nil }
-func (f *mockFile) ReadAt(p []byte, off int64) (n int, err error)  { return 0, nil }
-func (f *mockFile) Seek(offset int64, whence int) (int64, error)   { return 0, nil }
-func (f *mockFile) Sync() error                                    { return nil }
-func (f *mockFile) Truncate(size int64) error                      { return nil }
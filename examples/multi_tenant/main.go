@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"time"
+	"path"
 
 	"github.com/absfs/permfs"
 )
@@ -80,8 +80,11 @@ func (t *TenantFS) GetFS(tenantID string) (*permfs.PermFS, error) {
 }
 
 func main() {
-	// Create base filesystem
-	base := &mockFS{}
+	// Create an in-memory base filesystem with a file for each tenant
+	base := newExampleFS(
+		"/tenants/tenant-a/data.txt",
+		"/tenants/tenant-b/data.txt",
+	)
 
 	// Create multi-tenant filesystem manager
 	tenantFS := NewTenantFS(base)
@@ -176,65 +179,19 @@ func main() {
 	fmt.Println("\n✓ Multi-tenant isolation working correctly")
 }
 
-// mockFS implementation (same as basic example)
-type mockFS struct{}
-
-func (m *mockFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (permfs.File, error) {
-	return &mockFile{}, nil
-}
-
-func (m *mockFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
-	return nil
-}
-
-func (m *mockFS) MkdirAll(ctx context.Context, name string, perm os.FileMode) error {
-	return nil
-}
-
-func (m *mockFS) Remove(ctx context.Context, name string) error {
-	return nil
-}
-
-func (m *mockFS) RemoveAll(ctx context.Context, name string) error {
-	return nil
-}
-
-func (m *mockFS) Rename(ctx context.Context, oldname, newname string) error {
-	return nil
-}
-
-func (m *mockFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
-	return nil, nil
-}
-
-func (m *mockFS) Lstat(ctx context.Context, name string) (os.FileInfo, error) {
-	return nil, nil
-}
-
-func (m *mockFS) ReadDir(ctx context.Context, name string) ([]os.FileInfo, error) {
-	return nil, nil
-}
-
-func (m *mockFS) Chmod(ctx context.Context, name string, mode os.FileMode) error {
-	return nil
-}
-
-func (m *mockFS) Chown(ctx context.Context, name string, uid, gid int) error {
-	return nil
-}
-
-func (m *mockFS) Chtimes(ctx context.Context, name string, atime, mtime time.Time) error {
-	return nil
+// newExampleFS creates an in-memory filesystem pre-populated with empty files
+func newExampleFS(files ...string) *permfs.MemFS {
+	ctx := context.Background()
+	base := permfs.NewMemFS()
+	for _, name := range files {
+		if err := base.MkdirAll(ctx, path.Dir(name), 0755); err != nil {
+			log.Fatal(err)
+		}
+		f, err := base.OpenFile(ctx, name, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f.Close()
+	}
+	return base
 }
-
-type mockFile struct{}
-
-func (f *mockFile) Close() error                             { return nil }
-func (f *mockFile) Read(p []byte) (n int, err error)         { return 0, nil }
-func (f *mockFile) Stat() (os.FileInfo, error)               { return nil, nil }
-func (f *mockFile) Write(p []byte) (n int, err error)        { return len(p), nil }
-func (f *mockFile) WriteAt(p []byte, off int64) (n int, err error) { return len(p), nil }
-func (f *mockFile) ReadAt(p []byte, off int64) (n int, err error)  { return 0, nil }
-func (f *mockFile) Seek(offset int64, whence int) (int64, error)   { return 0, nil }
-func (f *mockFile) Sync() error                                    { return nil }
-func (f *mockFile) Truncate(size int64) error                      { return nil }
@@ -0,0 +1,743 @@
+package permfs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Compile-time interface checks
+var (
+	_ FileSystem = (*MemFS)(nil)
+	_ File       = (*memFile)(nil)
+)
+
+// MemFS is an in-memory implementation of FileSystem.
+// It supports directories, file contents, modes, ownership and timestamps,
+// and can be passed directly to New. All paths are interpreted relative to
+// the root "/" of the filesystem. Symbolic links are not supported, so Lstat
+// behaves like Stat.
+type MemFS struct {
+	mu   sync.RWMutex
+	root *memNode
+}
+
+// memNode is a single file or directory in a MemFS
+type memNode struct {
+	name     string
+	mode     os.FileMode
+	data     []byte
+	modTime  time.Time
+	atime    time.Time
+	uid      int
+	gid      int
+	children map[string]*memNode
+}
+
+// MemOwner is returned by Sys() on file info produced by MemFS
+type MemOwner struct {
+	// Uid is the numeric user ID of the owner
+	Uid int
+	// Gid is the numeric group ID of the owner
+	Gid int
+}
+
+// NewMemFS creates a new empty in-memory filesystem containing only the root directory
+func NewMemFS() *MemFS {
+	now := time.Now()
+	return &MemFS{
+		root: &memNode{
+			name:     "/",
+			mode:     os.ModeDir | 0755,
+			modTime:  now,
+			atime:    now,
+			children: make(map[string]*memNode),
+		},
+	}
+}
+
+// cleanMemPath normalizes a path to a rooted, slash-separated form
+func cleanMemPath(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+// splitMemPath splits a cleaned path into its components
+func splitMemPath(p string) []string {
+	if p == "/" {
+		return nil
+	}
+	return strings.Split(strings.TrimPrefix(p, "/"), "/")
+}
+
+// lookup finds the node for a cleaned path. The caller must hold mfs.mu.
+func (mfs *MemFS) lookup(p string) (*memNode, error) {
+	node := mfs.root
+	for _, part := range splitMemPath(p) {
+		if !node.mode.IsDir() {
+			return nil, fs.ErrNotExist
+		}
+		child, ok := node.children[part]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// lookupParent finds the parent directory of a cleaned path. The caller must hold mfs.mu.
+func (mfs *MemFS) lookupParent(p string) (*memNode, string, error) {
+	if p == "/" {
+		return nil, "", fs.ErrInvalid
+	}
+	dir, base := path.Split(p)
+	parent, err := mfs.lookup(path.Clean(dir))
+	if err != nil {
+		return nil, "", err
+	}
+	if !parent.mode.IsDir() {
+		return nil, "", fs.ErrNotExist
+	}
+	return parent, base, nil
+}
+
+// OpenFile opens a file with the specified flag and perm
+func (mfs *MemFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	p := cleanMemPath(name)
+	node, err := mfs.lookup(p)
+	if err != nil {
+		if flag&os.O_CREATE == 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		parent, base, perr := mfs.lookupParent(p)
+		if perr != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: perr}
+		}
+		now := time.Now()
+		node = &memNode{
+			name:    base,
+			mode:    perm &^ os.ModeType,
+			modTime: now,
+			atime:   now,
+		}
+		parent.children[base] = node
+		parent.modTime = now
+	} else {
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+		if node.mode.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: errIsDirectory}
+		}
+		if flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			node.data = nil
+			node.modTime = time.Now()
+		}
+	}
+
+	f := &memFile{
+		fs:   mfs,
+		node: node,
+		name: p,
+		flag: flag,
+	}
+	if flag&os.O_APPEND != 0 {
+		f.offset = int64(len(node.data))
+	}
+	return f, nil
+}
+
+// Mkdir creates a directory
+func (mfs *MemFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	p := cleanMemPath(name)
+	if _, err := mfs.lookup(p); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	parent, base, err := mfs.lookupParent(p)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	parent.children[base] = newMemDir(base, perm)
+	parent.modTime = time.Now()
+	return nil
+}
+
+// MkdirAll creates a directory and all parent directories
+func (mfs *MemFS) MkdirAll(ctx context.Context, name string, perm os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	node := mfs.root
+	for _, part := range splitMemPath(cleanMemPath(name)) {
+		child, ok := node.children[part]
+		if !ok {
+			child = newMemDir(part, perm)
+			node.children[part] = child
+			node.modTime = time.Now()
+		} else if !child.mode.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: errNotDirectory}
+		}
+		node = child
+	}
+	return nil
+}
+
+// newMemDir creates a new directory node
+func newMemDir(name string, perm os.FileMode) *memNode {
+	now := time.Now()
+	return &memNode{
+		name:     name,
+		mode:     os.ModeDir | perm.Perm(),
+		modTime:  now,
+		atime:    now,
+		children: make(map[string]*memNode),
+	}
+}
+
+// Remove removes a file or empty directory
+func (mfs *MemFS) Remove(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	p := cleanMemPath(name)
+	node, err := mfs.lookup(p)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if node.mode.IsDir() && len(node.children) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errDirectoryNotEmpty}
+	}
+	parent, base, err := mfs.lookupParent(p)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	delete(parent.children, base)
+	parent.modTime = time.Now()
+	return nil
+}
+
+// RemoveAll removes a path and any children it contains.
+// It returns nil if the path does not exist.
+func (mfs *MemFS) RemoveAll(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	p := cleanMemPath(name)
+	if p == "/" {
+		mfs.root.children = make(map[string]*memNode)
+		mfs.root.modTime = time.Now()
+		return nil
+	}
+	if _, err := mfs.lookup(p); err != nil {
+		return nil
+	}
+	parent, base, err := mfs.lookupParent(p)
+	if err != nil {
+		return &os.PathError{Op: "removeall", Path: name, Err: err}
+	}
+	delete(parent.children, base)
+	parent.modTime = time.Now()
+	return nil
+}
+
+// Rename renames (moves) a file or directory.
+// An existing file at newname is replaced; an existing directory is replaced
+// only if it is empty and oldname is also a directory.
+func (mfs *MemFS) Rename(ctx context.Context, oldname, newname string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	oldPath := cleanMemPath(oldname)
+	newPath := cleanMemPath(newname)
+
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	node, err := mfs.lookup(oldPath)
+	if err != nil {
+		return linkErr(err)
+	}
+	if oldPath == newPath {
+		return nil
+	}
+	if oldPath == "/" || strings.HasPrefix(newPath, oldPath+"/") {
+		return linkErr(fs.ErrInvalid)
+	}
+
+	newParent, newBase, err := mfs.lookupParent(newPath)
+	if err != nil {
+		return linkErr(err)
+	}
+	if existing, ok := newParent.children[newBase]; ok {
+		if existing.mode.IsDir() {
+			if !node.mode.IsDir() {
+				return linkErr(errIsDirectory)
+			}
+			if len(existing.children) > 0 {
+				return linkErr(errDirectoryNotEmpty)
+			}
+		} else if node.mode.IsDir() {
+			return linkErr(errNotDirectory)
+		}
+	}
+
+	oldParent, oldBase, err := mfs.lookupParent(oldPath)
+	if err != nil {
+		return linkErr(err)
+	}
+
+	now := time.Now()
+	delete(oldParent.children, oldBase)
+	oldParent.modTime = now
+	node.name = newBase
+	newParent.children[newBase] = node
+	newParent.modTime = now
+	return nil
+}
+
+// Stat returns file info
+func (mfs *MemFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mfs.mu.RLock()
+	defer mfs.mu.RUnlock()
+
+	node, err := mfs.lookup(cleanMemPath(name))
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return node.info(), nil
+}
+
+// Lstat returns file info. MemFS has no symbolic links so this is the same as Stat.
+func (mfs *MemFS) Lstat(ctx context.Context, name string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mfs.mu.RLock()
+	defer mfs.mu.RUnlock()
+
+	node, err := mfs.lookup(cleanMemPath(name))
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return node.info(), nil
+}
+
+// ReadDir reads the directory and returns file info sorted by name
+func (mfs *MemFS) ReadDir(ctx context.Context, name string) ([]os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mfs.mu.RLock()
+	defer mfs.mu.RUnlock()
+
+	node, err := mfs.lookup(cleanMemPath(name))
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !node.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errNotDirectory}
+	}
+	return node.sortedInfos(), nil
+}
+
+// Chmod changes the mode of the file
+func (mfs *MemFS) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	node, err := mfs.lookup(cleanMemPath(name))
+	if err != nil {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	node.mode = node.mode.Type() | mode.Perm()
+	return nil
+}
+
+// Chown changes the owner and group of the file
+func (mfs *MemFS) Chown(ctx context.Context, name string, uid, gid int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	node, err := mfs.lookup(cleanMemPath(name))
+	if err != nil {
+		return &os.PathError{Op: "chown", Path: name, Err: err}
+	}
+	// Follow os.Chown semantics: -1 leaves the value unchanged
+	if uid != -1 {
+		node.uid = uid
+	}
+	if gid != -1 {
+		node.gid = gid
+	}
+	return nil
+}
+
+// Chtimes changes the access and modification times
+func (mfs *MemFS) Chtimes(ctx context.Context, name string, atime, mtime time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+
+	node, err := mfs.lookup(cleanMemPath(name))
+	if err != nil {
+		return &os.PathError{Op: "chtimes", Path: name, Err: err}
+	}
+	node.atime = atime
+	node.modTime = mtime
+	return nil
+}
+
+// info returns a snapshot of the node's file info. The caller must hold the lock.
+func (n *memNode) info() os.FileInfo {
+	return &memFileInfo{
+		name:    n.name,
+		size:    int64(len(n.data)),
+		mode:    n.mode,
+		modTime: n.modTime,
+		owner:   MemOwner{Uid: n.uid, Gid: n.gid},
+	}
+}
+
+// sortedInfos returns file info for all children sorted by name. The caller must hold the lock.
+func (n *memNode) sortedInfos() []os.FileInfo {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	infos := make([]os.FileInfo, len(names))
+	for i, name := range names {
+		infos[i] = n.children[name].info()
+	}
+	return infos
+}
+
+// memFileInfo implements os.FileInfo for MemFS nodes
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	owner   MemOwner
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memFileInfo) Sys() interface{}   { return &fi.owner }
+
+// memFile is an open handle on a MemFS node
+type memFile struct {
+	fs        *MemFS
+	node      *memNode
+	name      string
+	flag      int
+	offset    int64
+	dirOffset int
+	closed    bool
+}
+
+// Name returns the path the file was opened with
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) checkOpen(op string) error {
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *memFile) readable() bool {
+	return f.flag&os.O_WRONLY == 0
+}
+
+func (f *memFile) writable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+// Stat returns file info for the handle
+func (f *memFile) Stat() (os.FileInfo, error) {
+	if err := f.checkOpen("stat"); err != nil {
+		return nil, err
+	}
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	return f.node.info(), nil
+}
+
+// Read reads data from the current offset
+func (f *memFile) Read(p []byte) (int, error) {
+	if err := f.checkOpen("read"); err != nil {
+		return 0, err
+	}
+	n, err := f.readAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// ReadAt reads data from the specified offset
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.checkOpen("read"); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.name, Err: fs.ErrInvalid}
+	}
+	n, err := f.readAt(p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *memFile) readAt(p []byte, off int64) (int, error) {
+	if !f.readable() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: fs.ErrPermission}
+	}
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.node.mode.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: errIsDirectory}
+	}
+	f.node.atime = time.Now()
+	if off >= int64(len(f.node.data)) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	return copy(p, f.node.data[off:]), nil
+}
+
+// Write writes data at the current offset, or at the end when opened with O_APPEND
+func (f *memFile) Write(p []byte) (int, error) {
+	if err := f.checkOpen("write"); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.fs.mu.RLock()
+		f.offset = int64(len(f.node.data))
+		f.fs.mu.RUnlock()
+	}
+	n, err := f.writeAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// WriteAt writes data at the specified offset
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.checkOpen("write"); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "writeat", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if f.flag&os.O_APPEND != 0 {
+		return 0, &os.PathError{Op: "writeat", Path: f.name, Err: errWriteAtInAppendMode}
+	}
+	return f.writeAt(p, off)
+}
+
+func (f *memFile) writeAt(p []byte, off int64) (int, error) {
+	if !f.writable() {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	end := off + int64(len(p))
+	if end > int64(len(f.node.data)) {
+		grown := make([]byte, end)
+		copy(grown, f.node.data)
+		f.node.data = grown
+	}
+	copy(f.node.data[off:], p)
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+// WriteString writes a string at the current offset
+func (f *memFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// Seek sets the offset for the next Read or Write
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.checkOpen("seek"); err != nil {
+		return 0, err
+	}
+
+	var base int64
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		base = f.offset
+	case io.SeekEnd:
+		f.fs.mu.RLock()
+		base = int64(len(f.node.data))
+		f.fs.mu.RUnlock()
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	if base+offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = base + offset
+	return f.offset, nil
+}
+
+// Sync is a no-op for in-memory files
+func (f *memFile) Sync() error {
+	return f.checkOpen("sync")
+}
+
+// Truncate changes the size of the file
+func (f *memFile) Truncate(size int64) error {
+	if err := f.checkOpen("truncate"); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if !f.writable() {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: fs.ErrPermission}
+	}
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.node.mode.IsDir() {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: errIsDirectory}
+	}
+	if size <= int64(len(f.node.data)) {
+		f.node.data = f.node.data[:size]
+	} else {
+		grown := make([]byte, size)
+		copy(grown, f.node.data)
+		f.node.data = grown
+	}
+	f.node.modTime = time.Now()
+	return nil
+}
+
+// Close closes the handle
+func (f *memFile) Close() error {
+	if err := f.checkOpen("close"); err != nil {
+		return err
+	}
+	f.closed = true
+	return nil
+}
+
+// Readdir reads directory entries in name order, following os.File.Readdir semantics
+func (f *memFile) Readdir(n int) ([]os.FileInfo, error) {
+	if err := f.checkOpen("readdir"); err != nil {
+		return nil, err
+	}
+
+	f.fs.mu.RLock()
+	if !f.node.mode.IsDir() {
+		f.fs.mu.RUnlock()
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: errNotDirectory}
+	}
+	infos := f.node.sortedInfos()
+	f.fs.mu.RUnlock()
+
+	if f.dirOffset >= len(infos) {
+		if n > 0 {
+			return nil, io.EOF
+		}
+		return []os.FileInfo{}, nil
+	}
+
+	infos = infos[f.dirOffset:]
+	if n > 0 && n < len(infos) {
+		infos = infos[:n]
+	}
+	f.dirOffset += len(infos)
+	return infos, nil
+}
+
+// Readdirnames reads directory entry names in name order
+func (f *memFile) Readdirnames(n int) ([]string, error) {
+	infos, err := f.Readdir(n)
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names, err
+}
+
+// ReadDir reads directory entries in name order as fs.DirEntry values
+func (f *memFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	infos, err := f.Readdir(n)
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fileInfoDirEntry{info}
+	}
+	return entries, err
+}
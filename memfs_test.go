@@ -0,0 +1,429 @@
+package permfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// seedMemFS creates a MemFS containing the given files (and their parent directories).
+// Paths ending in "/" are created as directories.
+func seedMemFS(t *testing.T, paths ...string) *MemFS {
+	t.Helper()
+	ctx := context.Background()
+	mfs := NewMemFS()
+	for _, p := range paths {
+		if p[len(p)-1] == '/' {
+			if err := mfs.MkdirAll(ctx, p, 0755); err != nil {
+				t.Fatalf("seed %s: %v", p, err)
+			}
+			continue
+		}
+		if err := mfs.MkdirAll(ctx, path.Dir(p), 0755); err != nil {
+			t.Fatalf("seed %s: %v", p, err)
+		}
+		f, err := mfs.OpenFile(ctx, p, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("seed %s: %v", p, err)
+		}
+		f.Write([]byte(p))
+		f.Close()
+	}
+	return mfs
+}
+
+// memExists reports whether a path exists in the MemFS
+func memExists(mfs *MemFS, p string) bool {
+	_, err := mfs.Stat(context.Background(), p)
+	return err == nil
+}
+
+func TestMemFSFileReadWrite(t *testing.T) {
+	ctx := context.Background()
+	mfs := NewMemFS()
+
+	if err := mfs.MkdirAll(ctx, "/home/alice", 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+
+	f, err := mfs.OpenFile(ctx, "/home/alice/notes.txt", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if _, err := f.Write([]byte("hello world")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("HELLO"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(data) != "HELLO world" {
+		t.Errorf("expected %q, got %q", "HELLO world", data)
+	}
+
+	buf := make([]byte, 5)
+	if n, err := f.ReadAt(buf, 6); err != nil || string(buf[:n]) != "world" {
+		t.Errorf("ReadAt = %q, %v", buf[:n], err)
+	}
+	if _, err := f.ReadAt(buf, 8); err != io.EOF {
+		t.Errorf("expected io.EOF from short ReadAt, got %v", err)
+	}
+
+	if err := f.Truncate(5); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size() != 5 || info.Name() != "notes.txt" || info.Mode() != 0644 {
+		t.Errorf("unexpected info: size=%d name=%s mode=%v", info.Size(), info.Name(), info.Mode())
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := f.Close(); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("expected fs.ErrClosed on double close, got %v", err)
+	}
+
+	// Append mode writes at the end
+	f, err = mfs.OpenFile(ctx, "/home/alice/notes.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile append failed: %v", err)
+	}
+	f.Write([]byte("!"))
+	f.Close()
+
+	f, _ = mfs.OpenFile(ctx, "/home/alice/notes.txt", os.O_RDONLY, 0)
+	data, _ = io.ReadAll(f)
+	f.Close()
+	if string(data) != "HELLO!" {
+		t.Errorf("expected %q after append, got %q", "HELLO!", data)
+	}
+
+	// Read-only handles cannot write
+	f, _ = mfs.OpenFile(ctx, "/home/alice/notes.txt", os.O_RDONLY, 0)
+	if _, err := f.Write([]byte("x")); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected fs.ErrPermission writing read-only handle, got %v", err)
+	}
+	f.Close()
+}
+
+func TestMemFSOpenFileFlags(t *testing.T) {
+	ctx := context.Background()
+	mfs := NewMemFS()
+
+	if _, err := mfs.OpenFile(ctx, "/missing.txt", os.O_RDONLY, 0); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+	if _, err := mfs.OpenFile(ctx, "/nodir/file.txt", os.O_CREATE|os.O_WRONLY, 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist for missing parent, got %v", err)
+	}
+
+	f, err := mfs.OpenFile(ctx, "/file.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	f.Write([]byte("data"))
+	f.Close()
+
+	if _, err := mfs.OpenFile(ctx, "/file.txt", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected fs.ErrExist with O_EXCL, got %v", err)
+	}
+
+	f, _ = mfs.OpenFile(ctx, "/file.txt", os.O_WRONLY|os.O_TRUNC, 0)
+	f.Close()
+	info, _ := mfs.Stat(ctx, "/file.txt")
+	if info.Size() != 0 {
+		t.Errorf("expected O_TRUNC to empty the file, size=%d", info.Size())
+	}
+
+	if _, err := mfs.OpenFile(ctx, "/", os.O_WRONLY, 0); err == nil {
+		t.Error("expected error opening directory for writing")
+	}
+}
+
+func TestMemFSDirectories(t *testing.T) {
+	ctx := context.Background()
+	mfs := NewMemFS()
+
+	if err := mfs.Mkdir(ctx, "/a", 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	if err := mfs.Mkdir(ctx, "/a", 0755); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected fs.ErrExist, got %v", err)
+	}
+	if err := mfs.Mkdir(ctx, "/x/y", 0755); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+	if err := mfs.MkdirAll(ctx, "/a/b/c", 0700); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := mfs.MkdirAll(ctx, "/a/b/c", 0700); err != nil {
+		t.Errorf("MkdirAll on existing path should succeed, got %v", err)
+	}
+
+	for _, name := range []string{"zeta.txt", "alpha.txt", "mid.txt"} {
+		f, _ := mfs.OpenFile(ctx, "/a/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		f.Close()
+	}
+
+	infos, err := mfs.ReadDir(ctx, "/a")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	expected := []string{"alpha.txt", "b", "mid.txt", "zeta.txt"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("entry %d: expected %s, got %s", i, expected[i], names[i])
+		}
+	}
+
+	if _, err := mfs.ReadDir(ctx, "/a/alpha.txt"); err == nil {
+		t.Error("expected error reading a file as a directory")
+	}
+	if err := mfs.MkdirAll(ctx, "/a/alpha.txt/sub", 0755); err == nil {
+		t.Error("expected error creating a directory below a file")
+	}
+
+	// Readdir through a handle pages in name order
+	d, err := mfs.OpenFile(ctx, "/a", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile dir failed: %v", err)
+	}
+	defer d.Close()
+	dir := d.(interface {
+		Readdir(int) ([]os.FileInfo, error)
+		Readdirnames(int) ([]string, error)
+	})
+	page, err := dir.Readdir(3)
+	if err != nil || len(page) != 3 || page[0].Name() != "alpha.txt" {
+		t.Fatalf("unexpected first page: %v, %v", page, err)
+	}
+	rest, err := dir.Readdirnames(3)
+	if err != nil || len(rest) != 1 || rest[0] != "zeta.txt" {
+		t.Fatalf("unexpected second page: %v, %v", rest, err)
+	}
+	if _, err := dir.Readdir(1); err != io.EOF {
+		t.Errorf("expected io.EOF at end of directory, got %v", err)
+	}
+}
+
+func TestMemFSRemove(t *testing.T) {
+	ctx := context.Background()
+	mfs := NewMemFS()
+
+	mfs.MkdirAll(ctx, "/projects/secret", 0755)
+	f, _ := mfs.OpenFile(ctx, "/projects/secret/plan.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	f.Close()
+
+	if err := mfs.Remove(ctx, "/projects/secret"); err == nil {
+		t.Error("expected Remove of non-empty directory to fail")
+	}
+	if err := mfs.Remove(ctx, "/projects/secret/plan.txt"); err != nil {
+		t.Errorf("Remove failed: %v", err)
+	}
+	if err := mfs.Remove(ctx, "/projects/secret/plan.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	f, _ = mfs.OpenFile(ctx, "/projects/secret/plan.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	f.Close()
+	if err := mfs.RemoveAll(ctx, "/projects"); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	if _, err := mfs.Stat(ctx, "/projects/secret/plan.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected subtree to be removed, got %v", err)
+	}
+	if err := mfs.RemoveAll(ctx, "/projects"); err != nil {
+		t.Errorf("RemoveAll of missing path should succeed, got %v", err)
+	}
+}
+
+func TestMemFSRename(t *testing.T) {
+	ctx := context.Background()
+	mfs := NewMemFS()
+
+	mfs.MkdirAll(ctx, "/src/sub", 0755)
+	mfs.MkdirAll(ctx, "/dst", 0755)
+	f, _ := mfs.OpenFile(ctx, "/src/sub/file.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	f.Write([]byte("moved"))
+	f.Close()
+
+	if err := mfs.Rename(ctx, "/src", "/dst/moved"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, err := mfs.Stat(ctx, "/src"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected old path to be gone, got %v", err)
+	}
+	f, err := mfs.OpenFile(ctx, "/dst/moved/sub/file.txt", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("expected moved file to exist: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "moved" {
+		t.Errorf("expected moved contents, got %q", data)
+	}
+	info, _ := mfs.Stat(ctx, "/dst/moved")
+	if info.Name() != "moved" {
+		t.Errorf("expected renamed directory name, got %s", info.Name())
+	}
+
+	if err := mfs.Rename(ctx, "/dst", "/dst/moved/inside"); err == nil {
+		t.Error("expected error renaming a directory into itself")
+	}
+	if err := mfs.Rename(ctx, "/missing", "/other"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+	if err := mfs.Rename(ctx, "/dst/moved/sub/file.txt", "/dst/moved"); err == nil {
+		t.Error("expected error replacing a non-empty directory with a file")
+	}
+
+	// Renaming over an existing file replaces it
+	f, _ = mfs.OpenFile(ctx, "/dst/other.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	f.Close()
+	if err := mfs.Rename(ctx, "/dst/moved/sub/file.txt", "/dst/other.txt"); err != nil {
+		t.Fatalf("Rename over file failed: %v", err)
+	}
+	info, _ = mfs.Stat(ctx, "/dst/other.txt")
+	if info.Size() != int64(len("moved")) {
+		t.Errorf("expected replaced file size %d, got %d", len("moved"), info.Size())
+	}
+}
+
+func TestMemFSMetadata(t *testing.T) {
+	ctx := context.Background()
+	mfs := NewMemFS()
+
+	f, _ := mfs.OpenFile(ctx, "/file.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	f.Close()
+
+	if err := mfs.Chmod(ctx, "/file.txt", 0600); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	if err := mfs.Chown(ctx, "/file.txt", 1000, 2000); err != nil {
+		t.Fatalf("Chown failed: %v", err)
+	}
+	if err := mfs.Chown(ctx, "/file.txt", -1, 3000); err != nil {
+		t.Fatalf("Chown failed: %v", err)
+	}
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := mfs.Chtimes(ctx, "/file.txt", mtime, mtime); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	info, err := mfs.Lstat(ctx, "/file.txt")
+	if err != nil {
+		t.Fatalf("Lstat failed: %v", err)
+	}
+	if info.Mode() != 0600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v, got %v", mtime, info.ModTime())
+	}
+	owner, ok := info.Sys().(*MemOwner)
+	if !ok {
+		t.Fatalf("expected *MemOwner from Sys(), got %T", info.Sys())
+	}
+	if owner.Uid != 1000 || owner.Gid != 3000 {
+		t.Errorf("expected owner 1000:3000, got %d:%d", owner.Uid, owner.Gid)
+	}
+
+	for _, err := range []error{
+		mfs.Chmod(ctx, "/missing", 0600),
+		mfs.Chown(ctx, "/missing", 1, 1),
+		mfs.Chtimes(ctx, "/missing", mtime, mtime),
+	} {
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected fs.ErrNotExist, got %v", err)
+		}
+	}
+}
+
+func TestMemFSContextCancelled(t *testing.T) {
+	mfs := NewMemFS()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := mfs.Mkdir(ctx, "/a", 0755); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := mfs.Stat(ctx, "/"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPermFSWithMemFS(t *testing.T) {
+	mfs := NewMemFS()
+	setup := context.Background()
+	mfs.MkdirAll(setup, "/home/alice", 0755)
+	mfs.MkdirAll(setup, "/home/bob", 0755)
+
+	acl := ACL{
+		Entries: []ACLEntry{
+			{
+				Subject:     User("alice"),
+				PathPattern: "/home/alice/**",
+				Permissions: ReadWrite | Delete,
+				Effect:      Allow,
+				Priority:    100,
+			},
+		},
+		Default: Deny,
+	}
+
+	pfs, err := New(mfs, Config{ACL: acl})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+
+	ctx := WithUser(context.Background(), "alice")
+	f, err := pfs.OpenFile(ctx, "/home/alice/doc.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("alice should be able to create her file: %v", err)
+	}
+	f.Write([]byte("content"))
+	f.Close()
+
+	info, err := mfs.Stat(setup, "/home/alice/doc.txt")
+	if err != nil {
+		t.Fatalf("expected file to exist in base filesystem: %v", err)
+	}
+	if info.Size() != int64(len("content")) {
+		t.Errorf("expected size %d, got %d", len("content"), info.Size())
+	}
+
+	if _, err := pfs.OpenFile(ctx, "/home/bob/doc.txt", os.O_CREATE|os.O_WRONLY, 0644); !IsPermissionDenied(err) {
+		t.Errorf("expected permission denied, got %v", err)
+	}
+	if _, err := mfs.Stat(setup, "/home/bob/doc.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("denied create must not touch the base filesystem, got %v", err)
+	}
+
+	if err := pfs.Remove(ctx, "/home/alice/doc.txt"); err != nil {
+		t.Fatalf("alice should be able to delete her file: %v", err)
+	}
+	if _, err := mfs.Stat(setup, "/home/alice/doc.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected file to be removed, got %v", err)
+	}
+}
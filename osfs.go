@@ -0,0 +1,349 @@
+package permfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Compile-time interface checks
+var (
+	_ FileSystem = (*OSFileSystem)(nil)
+	_ File       = (*osFile)(nil)
+)
+
+// maxSymlinkHops bounds symlink resolution to guard against loops
+const maxSymlinkHops = 255
+
+// OSFileSystem is a FileSystem backed by the host disk and rooted at a directory.
+// Every path is interpreted relative to the root; ".." components and symbolic
+// links that would resolve outside the root are refused with ErrPathEscapesRoot.
+// Resolution happens before each operation, so a concurrent process that can
+// swap directories for symlinks inside the root may still race the check.
+type OSFileSystem struct {
+	root string
+}
+
+// NewOSFileSystem creates a new filesystem rooted at the given host directory
+func NewOSFileSystem(root string) (*OSFileSystem, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: root, Err: errNotDirectory}
+	}
+	return &OSFileSystem{root: resolved}, nil
+}
+
+// Root returns the resolved host directory the filesystem is rooted at
+func (ofs *OSFileSystem) Root() string {
+	return ofs.root
+}
+
+// resolve maps a virtual path to a host path inside the root.
+// Symbolic links in intermediate components are always resolved and checked;
+// the final component is only followed when followFinal is true.
+func (ofs *OSFileSystem) resolve(name string, followFinal bool) (string, error) {
+	parts, err := splitRootedPath(filepath.ToSlash(name))
+	if err != nil {
+		return "", err
+	}
+
+	resolved := ofs.root
+	hops := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		next := filepath.Join(resolved, part)
+
+		if len(parts) == 0 && !followFinal {
+			return next, nil
+		}
+
+		info, err := os.Lstat(next)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			// Missing components cannot be links, so keep resolving lexically
+			resolved = next
+			continue
+		}
+
+		hops++
+		if hops > maxSymlinkHops {
+			return "", errTooManyLinks
+		}
+
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(resolved, target)
+		}
+		rel, err := filepath.Rel(ofs.root, filepath.Clean(target))
+		if err != nil || escapesRoot(filepath.ToSlash(rel)) {
+			return "", ErrPathEscapesRoot
+		}
+
+		// Restart from the root with the link target followed by the remaining components
+		targetParts, _ := splitRootedPath(filepath.ToSlash(rel))
+		parts = append(targetParts, parts...)
+		resolved = ofs.root
+	}
+
+	return resolved, nil
+}
+
+// splitRootedPath cleans a slash-separated path relative to "/" and splits it
+// into components, refusing any path whose ".." components climb above the root.
+func splitRootedPath(name string) ([]string, error) {
+	rel := path.Clean(strings.TrimLeft(name, "/"))
+	if escapesRoot(rel) {
+		return nil, ErrPathEscapesRoot
+	}
+	if rel == "." {
+		return nil, nil
+	}
+	return strings.Split(rel, "/"), nil
+}
+
+// escapesRoot reports whether a cleaned relative slash path leaves its base
+func escapesRoot(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, "../")
+}
+
+// hostPath resolves a path and wraps resolution failures as *os.PathError
+func (ofs *OSFileSystem) hostPath(op, name string, followFinal bool) (string, error) {
+	p, err := ofs.resolve(name, followFinal)
+	if err != nil {
+		return "", &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return p, nil
+}
+
+// hidePath rewrites host paths in errors back to the virtual name
+// so that callers never learn where the root lives on disk
+func hidePath(err error, name string) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return &os.PathError{Op: pathErr.Op, Path: name, Err: pathErr.Err}
+	}
+	return err
+}
+
+// OpenFile opens a file with the specified flag and perm
+func (ofs *OSFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p, err := ofs.hostPath("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(p, flag, perm)
+	if err != nil {
+		return nil, hidePath(err, name)
+	}
+	return &osFile{File: f, name: name}, nil
+}
+
+// Mkdir creates a directory
+func (ofs *OSFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p, err := ofs.hostPath("mkdir", name, true)
+	if err != nil {
+		return err
+	}
+	return hidePath(os.Mkdir(p, perm), name)
+}
+
+// MkdirAll creates a directory and all parent directories
+func (ofs *OSFileSystem) MkdirAll(ctx context.Context, name string, perm os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p, err := ofs.hostPath("mkdir", name, true)
+	if err != nil {
+		return err
+	}
+	return hidePath(os.MkdirAll(p, perm), name)
+}
+
+// Remove removes a file or empty directory. Symbolic links are removed, not followed.
+func (ofs *OSFileSystem) Remove(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p, err := ofs.hostPath("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if p == ofs.root {
+		return &os.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	return hidePath(os.Remove(p), name)
+}
+
+// RemoveAll removes a path and any children it contains. The root itself cannot be removed.
+func (ofs *OSFileSystem) RemoveAll(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p, err := ofs.hostPath("removeall", name, false)
+	if err != nil {
+		return err
+	}
+	if p == ofs.root {
+		return &os.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+	return hidePath(os.RemoveAll(p), name)
+}
+
+// Rename renames (moves) a file. Symbolic links are moved, not followed.
+func (ofs *OSFileSystem) Rename(ctx context.Context, oldname, newname string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	oldPath, err := ofs.resolve(oldname, false)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	newPath, err := ofs.resolve(newname, false)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	if oldPath == ofs.root || newPath == ofs.root {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		var linkErr *os.LinkError
+		if errors.As(err, &linkErr) {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: linkErr.Err}
+		}
+		return err
+	}
+	return nil
+}
+
+// Stat returns file info, following symbolic links within the root
+func (ofs *OSFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p, err := ofs.hostPath("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, hidePath(err, name)
+	}
+	return info, nil
+}
+
+// Lstat returns file info without following symlinks
+func (ofs *OSFileSystem) Lstat(ctx context.Context, name string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p, err := ofs.hostPath("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, hidePath(err, name)
+	}
+	return info, nil
+}
+
+// ReadDir reads the directory and returns file info sorted by name
+func (ofs *OSFileSystem) ReadDir(ctx context.Context, name string) ([]os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p, err := ofs.hostPath("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, hidePath(err, name)
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// The entry was removed after the directory was read
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, hidePath(err, name)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Chmod changes the mode of the file
+func (ofs *OSFileSystem) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p, err := ofs.hostPath("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	return hidePath(os.Chmod(p, mode), name)
+}
+
+// Chown changes the owner and group of the file
+func (ofs *OSFileSystem) Chown(ctx context.Context, name string, uid, gid int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p, err := ofs.hostPath("chown", name, true)
+	if err != nil {
+		return err
+	}
+	return hidePath(os.Chown(p, uid, gid), name)
+}
+
+// Chtimes changes the access and modification times
+func (ofs *OSFileSystem) Chtimes(ctx context.Context, name string, atime, mtime time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p, err := ofs.hostPath("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	return hidePath(os.Chtimes(p, atime, mtime), name)
+}
+
+// osFile wraps *os.File so that Name reports the virtual path rather than the host path
+type osFile struct {
+	*os.File
+	name string
+}
+
+// Name returns the path the file was opened with
+func (f *osFile) Name() string {
+	return f.name
+}
@@ -0,0 +1,291 @@
+package permfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestOSFileSystem creates an OSFileSystem rooted at <tmp>/root along with
+// a sibling <tmp>/outside directory containing a file that must never be reachable
+func newTestOSFileSystem(t *testing.T) (*OSFileSystem, string) {
+	t.Helper()
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	outside := filepath.Join(tmp, "outside")
+	for _, dir := range []string{root, outside} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ofs, err := NewOSFileSystem(root)
+	if err != nil {
+		t.Fatalf("NewOSFileSystem failed: %v", err)
+	}
+	return ofs, outside
+}
+
+func symlinkOrSkip(t *testing.T, oldname, newname string) {
+	t.Helper()
+	if err := os.Symlink(oldname, newname); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+}
+
+func TestNewOSFileSystem(t *testing.T) {
+	if _, err := NewOSFileSystem(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for missing root")
+	}
+
+	file := filepath.Join(t.TempDir(), "file.txt")
+	os.WriteFile(file, nil, 0644)
+	if _, err := NewOSFileSystem(file); err == nil {
+		t.Error("expected error for non-directory root")
+	}
+}
+
+func TestOSFileSystemOperations(t *testing.T) {
+	ofs, _ := newTestOSFileSystem(t)
+	ctx := context.Background()
+
+	if err := ofs.MkdirAll(ctx, "/a/b", 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := ofs.Mkdir(ctx, "/a/c", 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	f, err := ofs.OpenFile(ctx, "/a/b/file.txt", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if named, ok := f.(interface{ Name() string }); !ok || named.Name() != "/a/b/file.txt" {
+		t.Errorf("expected handle to report the virtual name")
+	}
+	f.Write([]byte("hello"))
+	f.Close()
+
+	data, err := os.ReadFile(filepath.Join(ofs.Root(), "a", "b", "file.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("expected file on disk, got %q, %v", data, err)
+	}
+
+	infos, err := ofs.ReadDir(ctx, "/a")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(infos) != 2 || infos[0].Name() != "b" || infos[1].Name() != "c" {
+		t.Errorf("unexpected ReadDir result: %v", infos)
+	}
+
+	if err := ofs.Rename(ctx, "/a/b/file.txt", "/a/c/moved.txt"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	info, err := ofs.Stat(ctx, "/a/c/moved.txt")
+	if err != nil || info.Size() != 5 {
+		t.Fatalf("Stat after rename: %v, %v", info, err)
+	}
+
+	if err := ofs.Chmod(ctx, "/a/c/moved.txt", 0600); err != nil {
+		t.Errorf("Chmod failed: %v", err)
+	}
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := ofs.Chtimes(ctx, "/a/c/moved.txt", mtime, mtime); err != nil {
+		t.Errorf("Chtimes failed: %v", err)
+	}
+	info, _ = ofs.Lstat(ctx, "/a/c/moved.txt")
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v, got %v", mtime, info.ModTime())
+	}
+	if err := ofs.Chown(ctx, "/a/c/moved.txt", -1, -1); err != nil {
+		t.Errorf("Chown with -1 should be a no-op, got %v", err)
+	}
+
+	if err := ofs.Remove(ctx, "/a/c/moved.txt"); err != nil {
+		t.Errorf("Remove failed: %v", err)
+	}
+	if err := ofs.RemoveAll(ctx, "/a"); err != nil {
+		t.Errorf("RemoveAll failed: %v", err)
+	}
+	if _, err := ofs.Stat(ctx, "/a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	if err := ofs.RemoveAll(ctx, "/"); err == nil {
+		t.Error("expected RemoveAll of the root to be refused")
+	}
+	if _, err := os.Stat(ofs.Root()); err != nil {
+		t.Errorf("root must survive RemoveAll(\"/\"): %v", err)
+	}
+}
+
+func TestOSFileSystemErrorsHideHostPath(t *testing.T) {
+	ofs, _ := newTestOSFileSystem(t)
+	ctx := context.Background()
+
+	_, err := ofs.Stat(ctx, "/missing.txt")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+	if strings.Contains(err.Error(), ofs.Root()) {
+		t.Errorf("error leaks host root: %v", err)
+	}
+}
+
+func TestOSFileSystemDotDotEscape(t *testing.T) {
+	ofs, _ := newTestOSFileSystem(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"../outside/secret.txt", "/../outside/secret.txt", "/a/../../outside/secret.txt"} {
+		if _, err := ofs.OpenFile(ctx, name, os.O_RDONLY, 0); !errors.Is(err, ErrPathEscapesRoot) {
+			t.Errorf("%s: expected ErrPathEscapesRoot, got %v", name, err)
+		}
+	}
+
+	// ".." that stays inside the root is fine
+	ofs.MkdirAll(ctx, "/a", 0755)
+	if _, err := ofs.Stat(ctx, "/a/../a"); err != nil {
+		t.Errorf("expected in-root .. to resolve, got %v", err)
+	}
+}
+
+func TestOSFileSystemSymlinkEscape(t *testing.T) {
+	ofs, outside := newTestOSFileSystem(t)
+	ctx := context.Background()
+	root := ofs.Root()
+
+	symlinkOrSkip(t, outside, filepath.Join(root, "abs-escape"))
+	symlinkOrSkip(t, filepath.Join("..", "outside"), filepath.Join(root, "rel-escape"))
+	symlinkOrSkip(t, filepath.Join(outside, "new.txt"), filepath.Join(root, "dangling"))
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"open through absolute link", func() error {
+			_, err := ofs.OpenFile(ctx, "/abs-escape/secret.txt", os.O_RDONLY, 0)
+			return err
+		}},
+		{"stat through relative link", func() error {
+			_, err := ofs.Stat(ctx, "/rel-escape/secret.txt")
+			return err
+		}},
+		{"readdir through link", func() error {
+			_, err := ofs.ReadDir(ctx, "/abs-escape")
+			return err
+		}},
+		{"create through dangling link", func() error {
+			_, err := ofs.OpenFile(ctx, "/dangling", os.O_CREATE|os.O_WRONLY, 0644)
+			return err
+		}},
+		{"chmod through link", func() error {
+			return ofs.Chmod(ctx, "/abs-escape/secret.txt", 0777)
+		}},
+		{"mkdir through link", func() error {
+			return ofs.MkdirAll(ctx, "/rel-escape/newdir", 0755)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, ErrPathEscapesRoot) {
+				t.Errorf("expected ErrPathEscapesRoot, got %v", err)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("file was created outside the root")
+	}
+
+	// Lstat and Remove operate on the link itself, which lives inside the root
+	info, err := ofs.Lstat(ctx, "/abs-escape")
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected Lstat to report the link, got %v, %v", info, err)
+	}
+	if err := ofs.Remove(ctx, "/abs-escape"); err != nil {
+		t.Errorf("expected link removal to succeed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "secret.txt")); err != nil {
+		t.Errorf("link target must be untouched: %v", err)
+	}
+}
+
+func TestOSFileSystemSymlinkInsideRoot(t *testing.T) {
+	ofs, _ := newTestOSFileSystem(t)
+	ctx := context.Background()
+	root := ofs.Root()
+
+	ofs.MkdirAll(ctx, "/data/real", 0755)
+	f, _ := ofs.OpenFile(ctx, "/data/real/file.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	f.Write([]byte("inside"))
+	f.Close()
+
+	symlinkOrSkip(t, "real", filepath.Join(root, "data", "rel"))
+	symlinkOrSkip(t, filepath.Join(root, "data", "real"), filepath.Join(root, "abs"))
+	symlinkOrSkip(t, "loop", filepath.Join(root, "loop"))
+
+	for _, name := range []string{"/data/rel/file.txt", "/abs/file.txt"} {
+		f, err := ofs.OpenFile(ctx, name, os.O_RDONLY, 0)
+		if err != nil {
+			t.Errorf("%s: expected in-root link to resolve, got %v", name, err)
+			continue
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		if string(data) != "inside" {
+			t.Errorf("%s: unexpected contents %q", name, data)
+		}
+	}
+
+	if _, err := ofs.Stat(ctx, "/loop"); err == nil {
+		t.Error("expected symlink loop to fail")
+	}
+}
+
+func TestPermFSWithOSFileSystem(t *testing.T) {
+	ofs, _ := newTestOSFileSystem(t)
+	ofs.MkdirAll(context.Background(), "/home/alice", 0755)
+
+	pfs, err := New(ofs, Config{
+		ACL: ACL{
+			Entries: []ACLEntry{
+				{
+					Subject:     User("alice"),
+					PathPattern: "/home/alice/**",
+					Permissions: ReadWrite,
+					Effect:      Allow,
+					Priority:    100,
+				},
+			},
+			Default: Deny,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+
+	ctx := WithUser(context.Background(), "alice")
+	f, err := pfs.OpenFile(ctx, "/home/alice/notes.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("expected alice to create her file: %v", err)
+	}
+	f.Close()
+
+	if _, err := os.Stat(filepath.Join(ofs.Root(), "home", "alice", "notes.txt")); err != nil {
+		t.Errorf("expected file on disk: %v", err)
+	}
+	if _, err := pfs.OpenFile(ctx, "/etc/passwd", os.O_RDONLY, 0); !IsPermissionDenied(err) {
+		t.Errorf("expected permission denied, got %v", err)
+	}
+}
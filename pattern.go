@@ -1,6 +1,7 @@
 package permfs
 
 import (
+	"fmt"
 	"path"
 	"path/filepath"
 	"strings"
@@ -12,14 +13,8 @@ import (
 //   - ** matches any sequence including separators (recursive)
 //   - ? matches any single non-separator character
 func matchPattern(pattern, pathStr string) (bool, error) {
-	// Normalize paths to use forward slashes for pattern matching
-	// This ensures consistent behavior across Windows, macOS, and Linux
-	pattern = filepath.ToSlash(filepath.Clean(pattern))
-	pathStr = filepath.ToSlash(filepath.Clean(pathStr))
-
-	// Use path.Clean (not filepath.Clean) to normalize with forward slashes
-	pattern = path.Clean(pattern)
-	pathStr = path.Clean(pathStr)
+	pattern = normalizePatternPath(pattern)
+	pathStr = normalizePatternPath(pathStr)
 
 	// Handle exact match
 	if pattern == pathStr {
@@ -40,109 +35,196 @@ func matchPattern(pattern, pathStr string) (bool, error) {
 	return matched, nil
 }
 
+// normalizePatternPath cleans a pattern or path and converts it to forward slashes.
+// This ensures consistent behavior across Windows, macOS, and Linux.
+func normalizePatternPath(p string) string {
+	// Use path.Clean (not filepath.Clean) to normalize with forward slashes
+	return path.Clean(filepath.ToSlash(filepath.Clean(p)))
+}
+
 // matchDoubleStarPattern handles patterns containing **
 func matchDoubleStarPattern(pattern, path string) (bool, error) {
-	// Split pattern into segments
-	patternParts := strings.Split(pattern, "/")
-	pathParts := strings.Split(path, "/")
-
-	return matchSegments(patternParts, pathParts, 0, 0)
+	return matchSegments(splitPattern(pattern), strings.Split(path, "/"))
 }
 
-// matchSegments recursively matches pattern segments against path segments
-func matchSegments(patternParts, pathParts []string, pi, pathi int) (bool, error) {
-	// If we've consumed all pattern parts
-	if pi >= len(patternParts) {
-		// Match if we've also consumed all path parts
-		return pathi >= len(pathParts), nil
-	}
+// patternSegment is one /-separated segment of a pattern
+type patternSegment struct {
+	text string
+	// glob is set when the segment contains syntax that path.Match interprets
+	glob bool
+	// doubleStar is set when the whole segment is **
+	doubleStar bool
+}
 
-	// If we've consumed all path parts but still have pattern parts
-	if pathi >= len(pathParts) {
-		// Only match if all remaining pattern parts are **
-		for i := pi; i < len(patternParts); i++ {
-			if patternParts[i] != "**" {
-				return false, nil
-			}
+// globChars are the characters that make a pattern segment more than a literal
+const globChars = `*?[\`
+
+// splitPattern splits a normalized pattern into classified segments
+func splitPattern(pattern string) []patternSegment {
+	parts := strings.Split(pattern, "/")
+	segments := make([]patternSegment, len(parts))
+	for i, part := range parts {
+		segments[i] = patternSegment{
+			text:       part,
+			glob:       strings.ContainsAny(part, globChars),
+			doubleStar: part == "**",
 		}
-		return true, nil
 	}
+	return segments
+}
 
-	currentPattern := patternParts[pi]
-
-	// Handle ** pattern
-	if currentPattern == "**" {
-		// ** can match zero or more path segments
-
-		// Try matching zero segments (skip the **)
-		matched, err := matchSegments(patternParts, pathParts, pi+1, pathi)
-		if err != nil {
-			return false, err
-		}
-		if matched {
-			return true, nil
-		}
-
-		// Try matching one or more segments
-		for i := pathi; i < len(pathParts); i++ {
-			matched, err := matchSegments(patternParts, pathParts, pi+1, i+1)
-			if err != nil {
-				return false, err
+// matchSegments matches pattern segments against path segments, where a **
+// segment matches zero or more path segments. On a mismatch only the most
+// recent ** is retried with one more segment: any match an earlier ** could
+// make by absorbing more segments, the later one can make too. This bounds the
+// work to len(segments)*len(pathParts) comparisons instead of backtracking
+// through every ** combination.
+func matchSegments(segments []patternSegment, pathParts []string) (bool, error) {
+	si, pi := 0, 0
+	starSi, starPi := -1, 0
+	for pi < len(pathParts) {
+		if si < len(segments) {
+			segment := segments[si]
+			if segment.doubleStar {
+				starSi, starPi = si, pi
+				si++
+				continue
+			}
+			matched := segment.text == pathParts[pi]
+			if segment.glob {
+				var err error
+				matched, err = path.Match(segment.text, pathParts[pi])
+				if err != nil {
+					return false, ErrInvalidPattern
+				}
 			}
 			if matched {
-				return true, nil
+				si++
+				pi++
+				continue
 			}
 		}
-
-		return false, nil
+		if starSi < 0 {
+			return false, nil
+		}
+		// Let the last ** absorb one more path segment and retry after it
+		starPi++
+		si, pi = starSi+1, starPi
 	}
 
-	// Handle regular patterns (with * and ?)
-	matched, err := path.Match(currentPattern, pathParts[pathi])
-	if err != nil {
-		return false, ErrInvalidPattern
+	// The path is consumed; only ** segments may remain
+	for ; si < len(segments); si++ {
+		if !segments[si].doubleStar {
+			return false, nil
+		}
 	}
+	return true, nil
+}
 
-	if !matched {
-		return false, nil
+// PatternSpecificity scores how narrowly a pattern selects paths; a higher score
+// is more specific. Segments rank literal > containing ? > containing * > **, so
+// the count of literal segments decides first, then ? segments, then * segments.
+// Remaining ties go to the pattern with more literal characters, so longer
+// patterns beat shorter ones. Only the order of scores is meaningful.
+func PatternSpecificity(pattern string) int {
+	var literal, question, star, chars int
+	for _, segment := range strings.Split(path.Clean("/"+filepath.ToSlash(pattern)), "/") {
+		switch {
+		case segment == "":
+			continue
+		case segment == "**":
+			continue
+		case strings.Contains(segment, "*"):
+			star++
+		case strings.Contains(segment, "?"):
+			question++
+		default:
+			literal++
+		}
+		chars += len(segment) - strings.Count(segment, "*") - strings.Count(segment, "?")
 	}
+	return clampSpecificity(literal)<<24 | clampSpecificity(question)<<16 |
+		clampSpecificity(star)<<8 | clampSpecificity(chars)
+}
 
-	// Continue with next segments
-	return matchSegments(patternParts, pathParts, pi+1, pathi+1)
+// clampSpecificity keeps each component of a specificity score within its byte
+func clampSpecificity(n int) int {
+	if n > 0xff {
+		return 0xff
+	}
+	return n
 }
 
-// PatternMatcher provides compiled pattern matching
+// PatternMatcher provides compiled pattern matching. The pattern is
+// normalized, classified and split into segments once, so matching only has to
+// normalize the path.
 type PatternMatcher struct {
 	pattern string
+	// hasGlob is set when any segment contains wildcard or escape syntax
 	hasGlob bool
+	// segments is set for patterns containing **, which are matched segment by segment
+	segments []patternSegment
+	// prefix holds the leading segments that contain no glob syntax
+	prefix []string
+	// specificity is the pattern's PatternSpecificity
+	specificity int
 }
 
-// NewPatternMatcher creates a new pattern matcher
+// NewPatternMatcher creates a new pattern matcher. It returns ErrInvalidPattern
+// if the pattern is malformed.
 func NewPatternMatcher(pattern string) (*PatternMatcher, error) {
-	// Normalize to forward slashes for consistent pattern matching
-	pattern = path.Clean(filepath.ToSlash(filepath.Clean(pattern)))
-	hasGlob := strings.ContainsAny(pattern, "*?")
-
-	return &PatternMatcher{
-		pattern: pattern,
-		hasGlob: hasGlob,
-	}, nil
+	pm := compilePattern(pattern)
+	if pm.hasGlob {
+		if _, err := path.Match(pm.pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPattern, pattern)
+		}
+	}
+	return pm, nil
+}
+
+// compilePattern builds a matcher without validating the pattern. A malformed
+// pattern matches only the path it is equal to, as with matchPattern.
+func compilePattern(pattern string) *PatternMatcher {
+	pm := &PatternMatcher{pattern: normalizePatternPath(pattern), specificity: PatternSpecificity(pattern)}
+	parts := strings.Split(pm.pattern, "/")
+	pm.prefix = parts
+	for i, part := range parts {
+		if strings.ContainsAny(part, globChars) {
+			pm.prefix = parts[:i]
+			pm.hasGlob = true
+			break
+		}
+	}
+	if strings.Contains(pm.pattern, "**") {
+		pm.segments = splitPattern(pm.pattern)
+	}
+	return pm
 }
 
 // Match checks if a path matches the pattern
 func (pm *PatternMatcher) Match(pathStr string) (bool, error) {
-	// Normalize to forward slashes for consistent pattern matching
-	normalizedPath := path.Clean(filepath.ToSlash(filepath.Clean(pathStr)))
+	return pm.matchClean(normalizePatternPath(pathStr)), nil
+}
 
+// matchClean matches an already normalized path, with the same result as matchPattern
+func (pm *PatternMatcher) matchClean(cleanPath string) bool {
 	// Fast path for exact matches
+	if pm.pattern == cleanPath {
+		return true
+	}
 	if !pm.hasGlob {
-		return pm.pattern == normalizedPath, nil
+		return false
 	}
-
-	return matchPattern(pm.pattern, pathStr)
+	if pm.segments != nil {
+		matched, err := matchSegments(pm.segments, strings.Split(cleanPath, "/"))
+		return err == nil && matched
+	}
+	// Without ** the pattern is matched as a whole, since a character class may match /
+	matched, err := path.Match(pm.pattern, cleanPath)
+	return err == nil && matched
 }
 
-// Pattern returns the original pattern string
+// Pattern returns the normalized pattern string
 func (pm *PatternMatcher) Pattern() string {
 	return pm.pattern
 }
@@ -1,6 +1,11 @@
 package permfs
 
 import (
+	"errors"
+	"math/rand"
+	"path"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -246,3 +251,128 @@ func BenchmarkPatternMatcherCompiled(b *testing.B) {
 		_, _ = matcher.Match(path)
 	}
 }
+
+func TestPatternSpecificity(t *testing.T) {
+	// Each pattern is strictly more specific than the next
+	ordered := []string{
+		"/projects/acme/public/readme.md",
+		"/projects/acme/public/**",
+		"/projects/acme/file?.txt",
+		"/projects/acme/*.txt",
+		"/projects/acme/*",
+		"/projects/acme/**",
+		"/projects/**",
+		"/**",
+	}
+	for i := 0; i+1 < len(ordered); i++ {
+		a, b := PatternSpecificity(ordered[i]), PatternSpecificity(ordered[i+1])
+		if a <= b {
+			t.Errorf("expected %s (%d) to be more specific than %s (%d)", ordered[i], a, ordered[i+1], b)
+		}
+	}
+
+	// Longer literal text wins among otherwise equal patterns
+	if PatternSpecificity("/data/reports/**") <= PatternSpecificity("/data/tmp/**") {
+		t.Error("expected the longer pattern to be more specific")
+	}
+	// Equivalent spellings score the same
+	if PatternSpecificity("/data/reports/") != PatternSpecificity("data/reports") {
+		t.Error("expected cleaned patterns to score the same")
+	}
+
+	// The score is computed once, when the pattern is compiled
+	for _, pattern := range ordered {
+		if got, want := compilePattern(pattern).specificity, PatternSpecificity(pattern); got != want {
+			t.Errorf("compiled %s has specificity %d, want %d", pattern, got, want)
+		}
+	}
+}
+
+func TestCompilePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		prefix  []string
+		hasGlob bool
+	}{
+		{"/home/alice/", []string{"", "home", "alice"}, false},
+		{"/projects/*/src", []string{"", "projects"}, true},
+		{"/data/**/*.txt", []string{"", "data"}, true},
+		{"docs/file?.md", []string{"docs"}, true},
+		{"/docs/[ab].md", []string{"", "docs"}, true},
+		{`/docs/\*`, []string{"", "docs"}, true},
+		{"/**", []string{""}, true},
+	}
+	for _, tt := range tests {
+		pm := compilePattern(tt.pattern)
+		if !reflect.DeepEqual(pm.prefix, tt.prefix) || pm.hasGlob != tt.hasGlob {
+			t.Errorf("compilePattern(%q) = prefix %q hasGlob %v, want %q %v",
+				tt.pattern, pm.prefix, pm.hasGlob, tt.prefix, tt.hasGlob)
+		}
+	}
+
+	if _, err := NewPatternMatcher("/data/[a-"); !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("expected ErrInvalidPattern for a malformed pattern, got %v", err)
+	}
+}
+
+// backtrackingMatch is the original recursive ** matcher, kept as a reference
+func backtrackingMatch(patternParts, pathParts []string) bool {
+	if len(patternParts) == 0 {
+		return len(pathParts) == 0
+	}
+	if patternParts[0] == "**" {
+		for i := 0; i <= len(pathParts); i++ {
+			if backtrackingMatch(patternParts[1:], pathParts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(pathParts) == 0 {
+		return false
+	}
+	matched, err := path.Match(patternParts[0], pathParts[0])
+	return err == nil && matched && backtrackingMatch(patternParts[1:], pathParts[1:])
+}
+
+func TestMatchSegmentsMatchesBacktracking(t *testing.T) {
+	rng := rand.New(rand.NewSource(22))
+	patternSegments := []string{"a", "b", "*", "**", "?", "[ab]", "a*"}
+	pathSegments := []string{"a", "b", "ab", "c", ""}
+	random := func(segments []string) []string {
+		parts := make([]string, rng.Intn(6))
+		for i := range parts {
+			parts[i] = segments[rng.Intn(len(segments))]
+		}
+		return parts
+	}
+
+	for i := 0; i < 20000; i++ {
+		pattern := strings.Join(random(patternSegments), "/")
+		name := strings.Join(random(pathSegments), "/")
+		got, err := matchSegments(splitPattern(pattern), strings.Split(name, "/"))
+		if err != nil {
+			t.Fatalf("matchSegments(%q, %q) failed: %v", pattern, name, err)
+		}
+		if want := backtrackingMatch(strings.Split(pattern, "/"), strings.Split(name, "/")); got != want {
+			t.Fatalf("matchSegments(%q, %q) = %v, want %v", pattern, name, got, want)
+		}
+	}
+}
+
+func TestDoubleStarPatternIsNotExponential(t *testing.T) {
+	// Many ** segments against a long non-matching path would take forever with backtracking
+	pattern := "/" + strings.Repeat("**/a/", 30) + "b"
+	name := "/" + strings.Repeat("a/", 60) + "c"
+
+	matcher, err := NewPatternMatcher(pattern)
+	if err != nil {
+		t.Fatalf("failed to create matcher: %v", err)
+	}
+	if matched, _ := matcher.Match(name); matched {
+		t.Error("expected no match")
+	}
+	if matched, _ := matcher.Match("/" + strings.Repeat("a/", 60) + "b"); !matched {
+		t.Error("expected a match")
+	}
+}
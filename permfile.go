@@ -0,0 +1,317 @@
+package permfs
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/absfs/absfs"
+)
+
+// Compile-time interface checks
+var _ File = (*permFile)(nil)
+
+// permFile wraps a File returned by the base filesystem so that operations on the
+// open handle are checked and audited against the same ACL as path-based calls.
+// Checks use the context the file was opened with.
+type permFile struct {
+	File
+	*openHandle
+	pfs *PermFS
+	ctx context.Context
+}
+
+// openHandle is what the registry knows of an open permFile. The registry does
+// not hold the permFile itself, so a handle that is never closed can still be
+// collected, and a finalizer then drops it from the registry.
+type openHandle struct {
+	name      string
+	userID    string
+	requestID string
+	revoked   atomic.Bool
+}
+
+// wrapFile returns f wrapped so that handle operations are enforced,
+// and registers it so that it can be revoked. Once the PermFS is closed,
+// new handles start out revoked.
+func (pfs *PermFS) wrapFile(ctx context.Context, name string, f File) File {
+	pf := &permFile{
+		File:       f,
+		openHandle: &openHandle{name: name, requestID: GetRequestID(ctx)},
+		pfs:        pfs,
+		ctx:        ctx,
+	}
+	if identity, err := GetIdentity(ctx); err == nil {
+		pf.userID = identity.UserID
+	}
+	if pfs.handles.add(pf.openHandle) {
+		runtime.SetFinalizer(pf, func(pf *permFile) {
+			pf.pfs.handles.remove(pf.openHandle)
+		})
+	}
+	return pf
+}
+
+// handleRegistry tracks the files opened through a PermFS that are still open
+type handleRegistry struct {
+	mu     sync.Mutex
+	files  map[*openHandle]struct{}
+	closed bool
+}
+
+func newHandleRegistry() *handleRegistry {
+	return &handleRegistry{files: make(map[*openHandle]struct{})}
+}
+
+// add registers h and reports whether it was registered. After close, h is
+// revoked instead.
+func (r *handleRegistry) add(h *openHandle) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		h.revoked.Store(true)
+		return false
+	}
+	r.files[h] = struct{}{}
+	return true
+}
+
+func (r *handleRegistry) remove(h *openHandle) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.files, h)
+}
+
+// len returns the number of registered handles
+func (r *handleRegistry) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.files)
+}
+
+// revoke marks every open handle of userID under pathPrefix as revoked and returns them.
+// An empty userID matches every user.
+func (r *handleRegistry) revoke(userID, pathPrefix string) []*openHandle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var revoked []*openHandle
+	for h := range r.files {
+		if userID != "" && h.userID != userID {
+			continue
+		}
+		if !hasPathPrefix(h.name, pathPrefix) {
+			continue
+		}
+		if h.revoked.CompareAndSwap(false, true) {
+			revoked = append(revoked, h)
+		}
+	}
+	return revoked
+}
+
+// close revokes and drops every registered handle, returning those it revoked,
+// and stops registering new ones
+func (r *handleRegistry) close() []*openHandle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var revoked []*openHandle
+	for h := range r.files {
+		if h.revoked.CompareAndSwap(false, true) {
+			revoked = append(revoked, h)
+		}
+	}
+	r.files = make(map[*openHandle]struct{})
+	r.closed = true
+	return revoked
+}
+
+// hasPathPrefix reports whether p is prefix or lies below it
+func hasPathPrefix(p, prefix string) bool {
+	p = cleanMemPath(p)
+	prefix = cleanMemPath(prefix)
+	if prefix == "/" || p == prefix {
+		return true
+	}
+	return strings.HasPrefix(p, prefix+"/")
+}
+
+// RevokeHandles revokes the open handles of userID on pathPrefix and everything below it.
+// An empty userID revokes the handles of every user. Subsequent operations on a revoked
+// handle, other than Close, fail with a PermissionError. Each revocation is audited.
+// It returns the number of handles revoked.
+func (pfs *PermFS) RevokeHandles(userID, pathPrefix string) int {
+	revoked := pfs.handles.revoke(userID, pathPrefix)
+	pfs.auditRevoked(revoked)
+	return len(revoked)
+}
+
+// auditRevoked records the revocation of handles
+func (pfs *PermFS) auditRevoked(revoked []*openHandle) {
+	for _, h := range revoked {
+		pfs.auditLogger.Log(&AuditEvent{
+			Timestamp: pfs.clock.Now(),
+			RequestID: h.requestID,
+			UserID:    h.userID,
+			Operation: "Revoke",
+			Path:      h.name,
+			Result:    AuditResultDenied,
+			Reason:    "open handle revoked",
+		})
+	}
+}
+
+// checkRevoked fails once the handle has been revoked
+func (pf *permFile) checkRevoked(op Operation) error {
+	if pf.revoked.Load() {
+		return NewPermissionError(pf.name, op, pf.userID, "open handle revoked")
+	}
+	return nil
+}
+
+// check fails if the handle has been revoked or op is no longer permitted on it
+func (pf *permFile) check(op Operation) error {
+	if err := pf.checkRevoked(op); err != nil {
+		return err
+	}
+	return pf.pfs.checkPermission(pf.ctx, pf.name, op)
+}
+
+// Read reads from the file unless the handle has been revoked
+func (pf *permFile) Read(p []byte) (int, error) {
+	if err := pf.checkRevoked(OperationRead); err != nil {
+		return 0, err
+	}
+	return pf.File.Read(p)
+}
+
+// ReadAt reads from the file at an offset unless the handle has been revoked
+func (pf *permFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := pf.checkRevoked(OperationRead); err != nil {
+		return 0, err
+	}
+	return pf.File.ReadAt(p, off)
+}
+
+// Close closes the file and stops tracking the handle
+func (pf *permFile) Close() error {
+	pf.pfs.handles.remove(pf.openHandle)
+	runtime.SetFinalizer(pf, nil)
+	return pf.File.Close()
+}
+
+// Name returns the name of the file as reported by the base file, or the opened path
+func (pf *permFile) Name() string {
+	if namer, ok := pf.File.(interface{ Name() string }); ok {
+		return namer.Name()
+	}
+	return pf.name
+}
+
+// Stat returns file info, requiring Metadata permission like PermFS.Stat
+func (pf *permFile) Stat() (os.FileInfo, error) {
+	if err := pf.check(OperationMetadata); err != nil {
+		return nil, err
+	}
+	return pf.File.Stat()
+}
+
+// Write writes to the file, requiring Write permission
+func (pf *permFile) Write(p []byte) (int, error) {
+	if err := pf.check(OperationWrite); err != nil {
+		return 0, err
+	}
+	return pf.File.Write(p)
+}
+
+// WriteAt writes to the file at an offset, requiring Write permission
+func (pf *permFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := pf.check(OperationWrite); err != nil {
+		return 0, err
+	}
+	return pf.File.WriteAt(p, off)
+}
+
+// Truncate changes the size of the file, requiring Write permission
+func (pf *permFile) Truncate(size int64) error {
+	if err := pf.check(OperationWrite); err != nil {
+		return err
+	}
+	return pf.File.Truncate(size)
+}
+
+// Readdir reads directory entries, requiring Read permission on the directory.
+// Entries are filtered according to Config.Enforcement.ListFilter.
+func (pf *permFile) Readdir(n int) ([]os.FileInfo, error) {
+	if err := pf.check(OperationRead); err != nil {
+		return nil, err
+	}
+	return pf.readdir(n)
+}
+
+// readdir reads from the base file without checking the directory itself
+func (pf *permFile) readdir(n int) ([]os.FileInfo, error) {
+	reader, ok := pf.File.(interface{ Readdir(int) ([]os.FileInfo, error) })
+	if !ok {
+		return nil, absfs.ErrNotImplemented
+	}
+	filter, err := pf.pfs.listingFilter(pf.ctx, pf.name)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		return reader.Readdir(n)
+	}
+
+	// Keep reading until a page has visible entries so that an empty
+	// result with a nil error is never returned for n > 0
+	for {
+		infos, err := reader.Readdir(n)
+		visible, filterErr := filter(infos)
+		if filterErr != nil {
+			return nil, filterErr
+		}
+		if len(visible) > 0 || err != nil || n <= 0 {
+			return visible, err
+		}
+	}
+}
+
+// Readdirnames reads directory entry names, requiring Read permission on the directory
+func (pf *permFile) Readdirnames(n int) ([]string, error) {
+	if err := pf.check(OperationRead); err != nil {
+		return nil, err
+	}
+	if reader, ok := pf.File.(interface{ Readdirnames(int) ([]string, error) }); ok && pf.pfs.config.Enforcement.ListFilter == 0 {
+		return reader.Readdirnames(n)
+	}
+
+	infos, err := pf.readdir(n)
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names, err
+}
+
+// ReadDir reads directory entries, requiring Read permission on the directory
+func (pf *permFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if err := pf.check(OperationRead); err != nil {
+		return nil, err
+	}
+	if reader, ok := pf.File.(interface{ ReadDir(int) ([]fs.DirEntry, error) }); ok && pf.pfs.config.Enforcement.ListFilter == 0 {
+		return reader.ReadDir(n)
+	}
+
+	infos, err := pf.readdir(n)
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fileInfoDirEntry{info}
+	}
+	return entries, err
+}
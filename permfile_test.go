@@ -0,0 +1,245 @@
+package permfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestPermFileHandleChecks(t *testing.T) {
+	mfs := seedMemFS(t, "/dir/a.txt", "/dir/b.txt", "/data.txt")
+
+	var events []*AuditEvent
+	pfs, _ := New(mfs, Config{
+		ACL: ACL{
+			Entries: []ACLEntry{
+				{
+					Subject:     User("alice"),
+					PathPattern: "/dir",
+					Permissions: Read,
+					Effect:      Allow,
+					Priority:    100,
+				},
+				{
+					Subject:     User("alice"),
+					PathPattern: "/dir/a.txt",
+					Permissions: Metadata,
+					Effect:      Allow,
+					Priority:    100,
+				},
+				{
+					Subject:     User("alice"),
+					PathPattern: "/data.txt",
+					Permissions: ReadWrite,
+					Effect:      Allow,
+					Priority:    100,
+				},
+			},
+			Default: Deny,
+		},
+		Enforcement: EnforcementConfig{ListFilter: OperationMetadata},
+		Audit: AuditConfig{
+			Enabled: true,
+			Writer:  io.Discard,
+			Handler: func(event *AuditEvent) { events = append(events, event) },
+		},
+	})
+	ctx := WithUser(context.Background(), "alice")
+
+	t.Run("Stat requires Metadata", func(t *testing.T) {
+		f, err := pfs.OpenFile(ctx, "/dir", os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+		if _, err := f.Stat(); !IsPermissionDenied(err) {
+			t.Errorf("expected permission denied, got %v", err)
+		}
+	})
+
+	t.Run("Readdir is filtered and audited", func(t *testing.T) {
+		f, err := pfs.OpenFile(ctx, "/dir", os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		events = nil
+		reader := f.(interface{ Readdirnames(int) ([]string, error) })
+		names, err := reader.Readdirnames(-1)
+		if err != nil {
+			t.Fatalf("Readdirnames failed: %v", err)
+		}
+		if len(names) != 1 || names[0] != "a.txt" {
+			t.Errorf("expected [a.txt], got %v", names)
+		}
+		// The directory read and each filtered entry are audited
+		if len(events) != 3 || events[0].Path != "/dir" || events[0].Operation != "Read" {
+			t.Fatalf("expected a Read audit event on /dir and one per entry, got %v", events)
+		}
+		for i, want := range []struct {
+			path   string
+			result AuditResult
+		}{{"/dir/a.txt", AuditResultAllowed}, {"/dir/b.txt", AuditResultDenied}} {
+			event := events[i+1]
+			if event.Path != want.path || event.Operation != "Metadata" || event.Result != want.result {
+				t.Errorf("expected %s on %s, got %s %s on %s", want.result, want.path, event.Result, event.Operation, event.Path)
+			}
+		}
+	})
+
+	t.Run("Write is rechecked after a rule change", func(t *testing.T) {
+		f, err := pfs.OpenFile(ctx, "/data.txt", os.O_RDWR, 0)
+		if err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.Write([]byte("ok")); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		pfs.RemoveRule(ACLEntry{
+			Subject:     User("alice"),
+			PathPattern: "/data.txt",
+			Permissions: ReadWrite,
+			Effect:      Allow,
+		})
+		if _, err := f.Write([]byte("no")); !IsPermissionDenied(err) {
+			t.Errorf("expected Write to be denied, got %v", err)
+		}
+		if _, err := f.WriteAt([]byte("no"), 0); !IsPermissionDenied(err) {
+			t.Errorf("expected WriteAt to be denied, got %v", err)
+		}
+		if err := f.Truncate(0); !IsPermissionDenied(err) {
+			t.Errorf("expected Truncate to be denied, got %v", err)
+		}
+	})
+}
+
+func TestPermFSRevokeHandles(t *testing.T) {
+	mfs := seedMemFS(t, "/shared/report.txt", "/shared/notes.txt", "/other/file.txt")
+
+	var events []*AuditEvent
+	pfs, _ := New(mfs, Config{
+		ACL: ACL{Default: Allow},
+		Audit: AuditConfig{
+			Enabled: true,
+			Level:   func() *AuditLevel { l := AuditLevelDenied; return &l }(),
+			Writer:  io.Discard,
+			Handler: func(event *AuditEvent) { events = append(events, event) },
+		},
+	})
+	alice := WithUser(context.Background(), "alice")
+	bob := WithUser(context.Background(), "bob")
+
+	open := func(ctx context.Context, name string) File {
+		t.Helper()
+		f, err := pfs.OpenFile(ctx, name, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatalf("OpenFile %s failed: %v", name, err)
+		}
+		return f
+	}
+	report := open(alice, "/shared/report.txt")
+	other := open(alice, "/other/file.txt")
+	bobs := open(bob, "/shared/notes.txt")
+	closed := open(alice, "/shared/notes.txt")
+	closed.Close()
+
+	if n := pfs.RevokeHandles("alice", "/shared"); n != 1 {
+		t.Errorf("expected 1 handle revoked, got %d", n)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := report.Read(buf); !IsPermissionDenied(err) {
+		t.Errorf("expected Read on revoked handle to be denied, got %v", err)
+	}
+	if _, err := report.ReadAt(buf, 0); !IsPermissionDenied(err) {
+		t.Errorf("expected ReadAt on revoked handle to be denied, got %v", err)
+	}
+	if _, err := report.Write(buf); !IsPermissionDenied(err) {
+		t.Errorf("expected Write on revoked handle to be denied, got %v", err)
+	}
+	if _, err := report.WriteAt(buf, 0); !IsPermissionDenied(err) {
+		t.Errorf("expected WriteAt on revoked handle to be denied, got %v", err)
+	}
+	if err := report.Close(); err != nil {
+		t.Errorf("expected Close on revoked handle to succeed, got %v", err)
+	}
+
+	if _, err := other.Read(buf); err != nil {
+		t.Errorf("expected handle outside the prefix to keep working, got %v", err)
+	}
+	if _, err := bobs.Read(buf); err != nil {
+		t.Errorf("expected another user's handle to keep working, got %v", err)
+	}
+
+	if len(events) != 1 || events[0].Operation != "Revoke" || events[0].Path != "/shared/report.txt" {
+		t.Errorf("expected one Revoke audit event, got %v", events)
+	}
+
+	if n := pfs.RevokeHandles("", "/"); n != 2 {
+		t.Errorf("expected every remaining handle revoked, got %d", n)
+	}
+	if _, err := bobs.Read(buf); !IsPermissionDenied(err) {
+		t.Errorf("expected Read to be denied after revoking all users, got %v", err)
+	}
+}
+
+func TestPermFSCloseRevokesHandles(t *testing.T) {
+	mfs := seedMemFS(t, "/shared/report.txt")
+	pfs, _ := New(mfs, Config{ACL: ACL{Default: Allow}})
+	ctx := WithUser(context.Background(), "alice")
+
+	f, err := pfs.OpenFile(ctx, "/shared/report.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if err := pfs.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if n := pfs.handles.len(); n != 0 {
+		t.Errorf("expected Close to drop every handle, %d left", n)
+	}
+	buf := make([]byte, 4)
+	if _, err := f.Read(buf); !IsPermissionDenied(err) {
+		t.Errorf("expected Read after Close to be denied, got %v", err)
+	}
+
+	// Handles opened after Close are revoked and not tracked
+	late, err := pfs.OpenFile(ctx, "/shared/report.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if _, err := late.Read(buf); !IsPermissionDenied(err) {
+		t.Errorf("expected a handle opened after Close to be revoked, got %v", err)
+	}
+	if n := pfs.handles.len(); n != 0 {
+		t.Errorf("expected no handles to be tracked after Close, got %d", n)
+	}
+}
+
+func TestHandleRegistryDropsLeakedHandles(t *testing.T) {
+	mfs := seedMemFS(t, "/shared/report.txt")
+	pfs, _ := New(mfs, Config{ACL: ACL{Default: Allow}})
+	ctx := WithUser(context.Background(), "alice")
+
+	// Handles that are never closed must not pin the registry
+	for i := 0; i < 100; i++ {
+		if _, err := pfs.OpenFile(ctx, "/shared/report.txt", os.O_RDONLY, 0); err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for pfs.handles.len() > 0 && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	if n := pfs.handles.len(); n != 0 {
+		t.Errorf("expected leaked handles to be dropped once collected, %d left", n)
+	}
+}
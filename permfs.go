@@ -2,8 +2,11 @@ package permfs
 
 import (
 	"context"
+	"fmt"
 	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
 	"time"
 )
 
@@ -72,6 +75,8 @@ type PermFS struct {
 	evaluator   *Evaluator
 	config      Config
 	auditLogger *AuditLogger
+	handles     *handleRegistry
+	clock       Clock
 }
 
 // New creates a new permission filesystem
@@ -109,17 +114,27 @@ func New(base FileSystem, config Config) (*PermFS, error) {
 	// Create audit logger
 	auditLogger := NewAuditLogger(config.Audit)
 
+	// Drive everything time-based from the configured clock
+	clock := clockOrSystem(config.Clock)
+	evaluator.clock = clock
+	if evaluator.cache != nil {
+		evaluator.cache.clock = clock
+	}
+	auditLogger.clock = clock
+
 	return &PermFS{
 		base:        base,
 		evaluator:   evaluator,
 		config:      config,
 		auditLogger: auditLogger,
+		handles:     newHandleRegistry(),
+		clock:       clock,
 	}, nil
 }
 
 // checkPermission checks if the operation is allowed
 func (pfs *PermFS) checkPermission(ctx context.Context, path string, op Operation) error {
-	startTime := time.Now()
+	startTime := pfs.clock.Now()
 
 	identity, err := GetIdentity(ctx)
 	if err != nil {
@@ -131,10 +146,11 @@ func (pfs *PermFS) checkPermission(ctx context.Context, path string, op Operatio
 		Path:      path,
 		Operation: op,
 		Metadata:  GetMetadata(ctx),
+		Time:      startTime,
 	}
 
-	allowed, err := pfs.evaluator.Evaluate(evalCtx)
-	duration := time.Since(startTime)
+	decision, err := pfs.evaluator.Decide(evalCtx)
+	duration := pfs.clock.Now().Sub(startTime)
 
 	// Log audit event
 	if pfs.auditLogger != nil {
@@ -148,6 +164,7 @@ func (pfs *PermFS) checkPermission(ctx context.Context, path string, op Operatio
 			Path:       path,
 			Duration:   duration,
 			Metadata:   evalCtx.Metadata,
+			RuleID:     decision.RuleID,
 		}
 
 		if sourceIP, ok := evalCtx.Metadata["source_ip"].(string); ok {
@@ -157,7 +174,7 @@ func (pfs *PermFS) checkPermission(ctx context.Context, path string, op Operatio
 		if err != nil {
 			event.Result = AuditResultError
 			event.Reason = err.Error()
-		} else if allowed {
+		} else if decision.Allowed {
 			event.Result = AuditResultAllowed
 		} else {
 			event.Result = AuditResultDenied
@@ -171,14 +188,22 @@ func (pfs *PermFS) checkPermission(ctx context.Context, path string, op Operatio
 		return err
 	}
 
-	if !allowed {
-		return NewPermissionError(path, op, identity.UserID, "access denied by ACL")
+	if !decision.Allowed {
+		return &PermissionError{
+			Path:      path,
+			Operation: op,
+			UserID:    identity.UserID,
+			Reason:    "access denied by ACL",
+			RuleID:    decision.RuleID,
+		}
 	}
 
 	return nil
 }
 
-// OpenFile opens a file with permission checking
+// OpenFile opens a file with permission checking.
+// The returned File checks Stat, Write, WriteAt, Truncate and directory reads
+// on the handle against the ACL using ctx.
 func (pfs *PermFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (File, error) {
 	// Determine the required operation based on flags
 	var requiredOp Operation
@@ -200,11 +225,15 @@ func (pfs *PermFS) OpenFile(ctx context.Context, name string, flag int, perm os.
 
 	// Check permission
 	if err := pfs.checkPermission(ctx, name, requiredOp); err != nil {
-		return nil, err
+		return nil, pfs.conceal(ctx, "open", name, err)
 	}
 
 	// Delegate to underlying filesystem
-	return pfs.base.OpenFile(ctx, name, flag, perm)
+	f, err := pfs.base.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return pfs.wrapFile(ctx, name, f), nil
 }
 
 // Mkdir creates a directory with permission checking
@@ -215,11 +244,15 @@ func (pfs *PermFS) Mkdir(ctx context.Context, name string, perm os.FileMode) err
 	return pfs.base.Mkdir(ctx, name, perm)
 }
 
-// MkdirAll creates a directory and all parents with permission checking
+// MkdirAll creates a directory and all parents with permission checking.
+// Missing intermediate directories are checked according to Config.Enforcement.MkdirAll.
 func (pfs *PermFS) MkdirAll(ctx context.Context, name string, perm os.FileMode) error {
 	if err := pfs.checkPermission(ctx, name, OperationWrite); err != nil {
 		return err
 	}
+	if err := pfs.checkMkdirAllAncestors(ctx, name); err != nil {
+		return err
+	}
 	return pfs.base.MkdirAll(ctx, name, perm)
 }
 
@@ -231,15 +264,25 @@ func (pfs *PermFS) Remove(ctx context.Context, name string) error {
 	return pfs.base.Remove(ctx, name)
 }
 
-// RemoveAll removes a path recursively with permission checking
+// RemoveAll removes a path recursively with permission checking.
+// Descendants are checked according to Config.Enforcement.RemoveAll.
 func (pfs *PermFS) RemoveAll(ctx context.Context, name string) error {
 	if err := pfs.checkPermission(ctx, name, OperationDelete); err != nil {
 		return err
 	}
-	return pfs.base.RemoveAll(ctx, name)
+
+	switch pfs.config.Enforcement.RemoveAll {
+	case RemoveAllPreflight:
+		return pfs.removeAllPreflight(ctx, name)
+	case RemoveAllPartial:
+		return pfs.removeAllPartial(ctx, name)
+	default:
+		return pfs.base.RemoveAll(ctx, name)
+	}
 }
 
-// Rename renames a file with permission checking
+// Rename renames a file with permission checking.
+// Directories are checked according to Config.Enforcement.Rename.
 func (pfs *PermFS) Rename(ctx context.Context, oldname, newname string) error {
 	// Need delete permission on old path and write permission on new path
 	if err := pfs.checkPermission(ctx, oldname, OperationDelete); err != nil {
@@ -248,13 +291,16 @@ func (pfs *PermFS) Rename(ctx context.Context, oldname, newname string) error {
 	if err := pfs.checkPermission(ctx, newname, OperationWrite); err != nil {
 		return err
 	}
+	if pfs.config.Enforcement.Rename == RenameCheckSubtree {
+		return pfs.renameSubtree(ctx, oldname, newname)
+	}
 	return pfs.base.Rename(ctx, oldname, newname)
 }
 
 // Stat returns file info with permission checking
 func (pfs *PermFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
 	if err := pfs.checkPermission(ctx, name, OperationMetadata); err != nil {
-		return nil, err
+		return nil, pfs.conceal(ctx, "stat", name, err)
 	}
 	return pfs.base.Stat(ctx, name)
 }
@@ -262,18 +308,54 @@ func (pfs *PermFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
 // Lstat returns file info without following symlinks, with permission checking
 func (pfs *PermFS) Lstat(ctx context.Context, name string) (os.FileInfo, error) {
 	if err := pfs.checkPermission(ctx, name, OperationMetadata); err != nil {
-		return nil, err
+		return nil, pfs.conceal(ctx, "lstat", name, err)
 	}
 	return pfs.base.Lstat(ctx, name)
 }
 
 // ReadDir reads a directory with permission checking (context-based, returns []os.FileInfo)
-// This method implements the internal FileSystem interface
+// This method implements the internal FileSystem interface.
+// Entries are filtered according to Config.Enforcement.ListFilter.
 func (pfs *PermFS) ReadDir(ctx context.Context, name string) ([]os.FileInfo, error) {
 	if err := pfs.checkPermission(ctx, name, OperationRead); err != nil {
+		return nil, pfs.conceal(ctx, "readdir", name, err)
+	}
+	filter, err := pfs.listingFilter(ctx, name)
+	if err != nil {
 		return nil, err
 	}
-	return pfs.base.ReadDir(ctx, name)
+	infos, err := pfs.base.ReadDir(ctx, name)
+	if err != nil || filter == nil {
+		return infos, err
+	}
+	return filter(infos)
+}
+
+// listingFilter returns a function that drops directory entries the identity in ctx
+// may not see, or nil when no listing filter is configured. Each entry is checked
+// like any other request, so the audit log records the entries that were hidden
+// at the configured audit level. It fails if ctx carries no identity.
+func (pfs *PermFS) listingFilter(ctx context.Context, dir string) (func([]os.FileInfo) ([]os.FileInfo, error), error) {
+	op := pfs.config.Enforcement.ListFilter
+	if op == 0 {
+		return nil, nil
+	}
+	if _, err := GetIdentity(ctx); err != nil {
+		return nil, err
+	}
+
+	return func(infos []os.FileInfo) ([]os.FileInfo, error) {
+		visible := make([]os.FileInfo, 0, len(infos))
+		for _, info := range infos {
+			err := pfs.checkPermission(ctx, path.Join(filepath.ToSlash(dir), info.Name()), op)
+			if err == nil {
+				visible = append(visible, info)
+			} else if _, denied := asPermissionError(err); !denied {
+				return nil, err
+			}
+		}
+		return visible, nil
+	}, nil
 }
 
 // Chmod changes file mode with permission checking
@@ -311,37 +393,75 @@ func (pfs *PermFS) GetPermissions(ctx context.Context, path string) (Operation,
 
 // GetEffectiveRules returns all ACL entries that apply to a path
 func (pfs *PermFS) GetEffectiveRules(path string) []ACLEntry {
-	var effective []ACLEntry
-	for _, entry := range pfs.evaluator.acl.Entries {
-		matched, _ := matchPattern(entry.PathPattern, path)
-		if matched {
-			effective = append(effective, entry)
-		}
-	}
-	return effective
+	return pfs.evaluator.entriesForPath(path)
 }
 
-// AddRule adds a new ACL entry (for dynamic rule management)
+// UpdateACL applies a batch of rule changes atomically. fn receives a copy of the
+// current ACL; if it returns nil the modified ACL replaces the current one in a
+// single step and the cache is invalidated once. If it returns an error, nothing changes.
+func (pfs *PermFS) UpdateACL(fn func(*ACL) error) error {
+	return pfs.evaluator.UpdateACL(fn)
+}
+
+// AddRule adds a new ACL entry (for dynamic rule management).
+// It returns ErrDuplicateRuleID if the entry's ID is already in use.
 func (pfs *PermFS) AddRule(entry ACLEntry) error {
-	pfs.evaluator.acl.Entries = append(pfs.evaluator.acl.Entries, entry)
-	// Invalidate cache since rules have changed
-	pfs.ClearCache()
-	return nil
+	return pfs.UpdateACL(func(acl *ACL) error {
+		if entry.ID != "" && acl.indexOf(entry.ID) >= 0 {
+			return fmt.Errorf("%w: %s", ErrDuplicateRuleID, entry.ID)
+		}
+		acl.Entries = append(acl.Entries, entry)
+		return nil
+	})
 }
 
 // RemoveRule removes an ACL entry by matching all fields
 func (pfs *PermFS) RemoveRule(entry ACLEntry) error {
-	var newEntries []ACLEntry
-	for _, e := range pfs.evaluator.acl.Entries {
-		if e.Subject != entry.Subject || e.PathPattern != entry.PathPattern ||
-			e.Permissions != entry.Permissions || e.Effect != entry.Effect {
-			newEntries = append(newEntries, e)
+	return pfs.UpdateACL(func(acl *ACL) error {
+		var newEntries []ACLEntry
+		for _, e := range acl.Entries {
+			if e.Subject != entry.Subject || e.PathPattern != entry.PathPattern ||
+				e.Permissions != entry.Permissions || e.Effect != entry.Effect {
+				newEntries = append(newEntries, e)
+			}
+		}
+		acl.Entries = newEntries
+		return nil
+	})
+}
+
+// RemoveRuleByID removes the ACL entry with the given ID.
+// It returns ErrRuleNotFound if there is none.
+func (pfs *PermFS) RemoveRuleByID(id string) error {
+	return pfs.UpdateACL(func(acl *ACL) error {
+		i := acl.indexOf(id)
+		if id == "" || i < 0 {
+			return fmt.Errorf("%w: %s", ErrRuleNotFound, id)
 		}
+		acl.Entries = append(acl.Entries[:i], acl.Entries[i+1:]...)
+		return nil
+	})
+}
+
+// GetRule returns the ACL entry with the given ID
+func (pfs *PermFS) GetRule(id string) (ACLEntry, bool) {
+	acl := pfs.evaluator.snapshot()
+	if i := acl.indexOf(id); id != "" && i >= 0 {
+		return acl.Entries[i], true
 	}
-	pfs.evaluator.acl.Entries = newEntries
-	// Invalidate cache since rules have changed
-	pfs.ClearCache()
-	return nil
+	return ACLEntry{}, false
+}
+
+// ListRules returns the ACL entries that carry every one of tags, in ACL order.
+// With no tags it returns all entries.
+func (pfs *PermFS) ListRules(tags ...string) []ACLEntry {
+	var rules []ACLEntry
+	for _, entry := range pfs.evaluator.snapshot().Entries {
+		if entry.HasTags(tags...) {
+			rules = append(rules, entry)
+		}
+	}
+	return rules
 }
 
 // ClearCache clears the permission cache
@@ -375,8 +495,11 @@ func (pfs *PermFS) GetAuditMetrics() *AuditMetrics {
 	return nil
 }
 
-// Close closes the permission filesystem and shuts down background tasks
+// Close closes the permission filesystem and shuts down background tasks.
+// Every open handle is revoked and dropped, and handles opened afterwards
+// start out revoked.
 func (pfs *PermFS) Close() error {
+	pfs.auditRevoked(pfs.handles.close())
 	if pfs.auditLogger != nil {
 		return pfs.auditLogger.Close()
 	}
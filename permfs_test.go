@@ -3,7 +3,9 @@ package permfs
 import (
 	"context"
 	"errors"
+	"io"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -361,6 +363,231 @@ func TestPermFSRenamePermissions(t *testing.T) {
 	}
 }
 
+func TestPermFSRenameSubtree(t *testing.T) {
+	acl := ACL{
+		Entries: []ACLEntry{
+			{
+				Subject:     User("alice"),
+				PathPattern: "/projects/**",
+				Permissions: ReadWrite | Delete,
+				Effect:      Allow,
+				Priority:    10,
+			},
+			{
+				Subject:     User("alice"),
+				PathPattern: "/projects/locked/secret/**",
+				Permissions: Delete,
+				Effect:      Deny,
+				Priority:    100,
+			},
+			{
+				Subject:     User("alice"),
+				PathPattern: "/projects/readonly/**",
+				Permissions: Write | Delete,
+				Effect:      Deny,
+				Priority:    100,
+			},
+			{
+				Subject:     User("alice"),
+				PathPattern: "/projects/readonly",
+				Permissions: Delete,
+				Effect:      Allow,
+				Priority:    200,
+			},
+			{
+				Subject:     User("alice"),
+				PathPattern: "/projects/admin/**",
+				Permissions: Admin,
+				Effect:      Allow,
+				Priority:    10,
+			},
+		},
+		Default: Deny,
+	}
+	files := []string{
+		"/projects/locked/secret/keys.txt",
+		"/projects/locked/notes.txt",
+		"/projects/readonly/report.txt",
+		"/projects/admin/data.txt",
+		"/projects/open/data.txt",
+	}
+
+	t.Run("check endpoints moves protected subtree", func(t *testing.T) {
+		mfs := seedMemFS(t, files...)
+		pfs, _ := New(mfs, Config{
+			ACL:         acl,
+			Enforcement: EnforcementConfig{Rename: RenameCheckEndpoints},
+		})
+		ctx := WithUser(context.Background(), "alice")
+
+		if err := pfs.Rename(ctx, "/projects/locked", "/projects/moved"); err != nil {
+			t.Fatalf("expected legacy rename to succeed: %v", err)
+		}
+		if !memExists(mfs, "/projects/moved/secret/keys.txt") {
+			t.Error("expected subtree to be moved")
+		}
+	})
+
+	t.Run("subtree refuses denied source", func(t *testing.T) {
+		// Subtree checking is the default
+		mfs := seedMemFS(t, files...)
+		pfs, _ := New(mfs, Config{ACL: acl})
+		ctx := WithUser(context.Background(), "alice")
+
+		err := pfs.Rename(ctx, "/projects/locked", "/projects/moved")
+		var multiErr *MultiPathError
+		if !errors.As(err, &multiErr) {
+			t.Fatalf("expected *MultiPathError, got %v", err)
+		}
+		if multiErr.Op != "rename" {
+			t.Errorf("expected op rename, got %s", multiErr.Op)
+		}
+		denied := multiErr.DeniedPaths()
+		if len(denied) != 2 || denied[0] != "/projects/locked/secret" || denied[1] != "/projects/locked/secret/keys.txt" {
+			t.Errorf("unexpected denied paths: %v", denied)
+		}
+		if !memExists(mfs, "/projects/locked/secret/keys.txt") {
+			t.Error("expected nothing to be moved")
+		}
+	})
+
+	t.Run("subtree refuses denied destination", func(t *testing.T) {
+		mfs := seedMemFS(t, files...)
+		pfs, _ := New(mfs, Config{
+			ACL:         acl,
+			Enforcement: EnforcementConfig{Rename: RenameCheckSubtree},
+		})
+		ctx := WithUser(context.Background(), "alice")
+
+		// The directory itself may be written at the destination, its children may not
+		pfs.AddRule(ACLEntry{
+			Subject:     User("alice"),
+			PathPattern: "/projects/readonly/open",
+			Permissions: Write,
+			Effect:      Allow,
+			Priority:    200,
+		})
+		err := pfs.Rename(ctx, "/projects/open", "/projects/readonly/open")
+		if !IsPermissionDenied(err) {
+			t.Fatalf("expected permission denied, got %v", err)
+		}
+		if !memExists(mfs, "/projects/open/data.txt") {
+			t.Error("expected nothing to be moved")
+		}
+	})
+
+	t.Run("subtree allows clean move", func(t *testing.T) {
+		mfs := seedMemFS(t, files...)
+		pfs, _ := New(mfs, Config{
+			ACL:         acl,
+			Enforcement: EnforcementConfig{Rename: RenameCheckSubtree},
+		})
+		ctx := WithUser(context.Background(), "alice")
+
+		if err := pfs.Rename(ctx, "/projects/open", "/projects/moved"); err != nil {
+			t.Fatalf("expected rename to succeed: %v", err)
+		}
+		if !memExists(mfs, "/projects/moved/data.txt") {
+			t.Error("expected subtree to be moved")
+		}
+	})
+
+	escalation := func(policy RenameEscalationPolicy) (*MemFS, *PermFS) {
+		mfs := seedMemFS(t, files...)
+		pfs, _ := New(mfs, Config{
+			ACL: acl,
+			Enforcement: EnforcementConfig{
+				Rename:           RenameCheckSubtree,
+				RenameEscalation: policy,
+			},
+		})
+		return mfs, pfs
+	}
+
+	t.Run("escalation deny refuses gaining permissions", func(t *testing.T) {
+		// Moving /projects/open into /projects/admin gains Admin on every path
+		mfs, pfs := escalation(RenameEscalationDeny)
+		ctx := WithUser(context.Background(), "alice")
+
+		err := pfs.Rename(ctx, "/projects/open", "/projects/admin/open")
+		var multiErr *MultiPathError
+		if !errors.As(err, &multiErr) {
+			t.Fatalf("expected *MultiPathError, got %v", err)
+		}
+		if len(multiErr.Denied) != 2 {
+			t.Errorf("expected both moved paths to be denied, got %v", multiErr.DeniedPaths())
+		}
+		if !memExists(mfs, "/projects/open/data.txt") {
+			t.Error("expected nothing to be moved")
+		}
+
+		// Moving out of the admin area loses permissions, which is fine
+		if err := pfs.Rename(ctx, "/projects/admin/data.txt", "/projects/data.txt"); err != nil {
+			t.Errorf("expected de-escalating rename to succeed: %v", err)
+		}
+	})
+
+	t.Run("escalation require admin", func(t *testing.T) {
+		mfs, pfs := escalation(RenameEscalationRequireAdmin)
+		ctx := WithUser(context.Background(), "alice")
+
+		if err := pfs.Rename(ctx, "/projects/open", "/projects/admin/open"); !IsPermissionDenied(err) {
+			t.Fatalf("expected permission denied without Admin on source, got %v", err)
+		}
+
+		pfs.AddRule(ACLEntry{
+			Subject:     User("alice"),
+			PathPattern: "/projects/open/**",
+			Permissions: Admin,
+			Effect:      Allow,
+			Priority:    10,
+		})
+		pfs.AddRule(ACLEntry{
+			Subject:     User("alice"),
+			PathPattern: "/projects/open",
+			Permissions: Admin,
+			Effect:      Allow,
+			Priority:    10,
+		})
+		if err := pfs.Rename(ctx, "/projects/open", "/projects/admin/open"); err != nil {
+			t.Fatalf("expected rename with Admin on source to succeed: %v", err)
+		}
+		if !memExists(mfs, "/projects/admin/open/data.txt") {
+			t.Error("expected subtree to be moved")
+		}
+	})
+
+	t.Run("escalation uses the request context", func(t *testing.T) {
+		// Admin in the vault is only granted to requests made with MFA
+		mfs, pfs := escalation(RenameEscalationDeny)
+		if err := mfs.MkdirAll(context.Background(), "/projects/vault", 0755); err != nil {
+			t.Fatal(err)
+		}
+		pfs.AddRule(ACLEntry{
+			Subject:     User("alice"),
+			PathPattern: "/projects/vault/**",
+			Permissions: Admin,
+			Effect:      Allow,
+			Priority:    10,
+			Conditions:  []Condition{&MetadataCondition{Key: "mfa", Values: []string{"true"}}},
+		})
+		ctx := WithMetadata(WithUser(context.Background(), "alice"), map[string]interface{}{"mfa": "true"})
+
+		if err := pfs.Rename(ctx, "/projects/open", "/projects/vault/open"); !IsPermissionDenied(err) {
+			t.Fatalf("expected the conditional grant to count as escalation, got %v", err)
+		}
+		if !memExists(mfs, "/projects/open/data.txt") {
+			t.Error("expected nothing to be moved")
+		}
+
+		// Without MFA the move gains nothing
+		ctx = WithUser(context.Background(), "alice")
+		if err := pfs.Rename(ctx, "/projects/open", "/projects/vault/open"); err != nil {
+			t.Fatalf("expected rename without MFA to succeed: %v", err)
+		}
+	})
+}
+
 func TestPermFSStatPermissions(t *testing.T) {
 	mock := &mockFileSystem{}
 	acl := ACL{
@@ -546,6 +773,79 @@ func TestAddRemoveRule(t *testing.T) {
 	}
 }
 
+func TestPermFSRulesByID(t *testing.T) {
+	mock := &mockFileSystem{shouldReturnFile: true}
+	var events []*AuditEvent
+	pfs, err := New(mock, Config{
+		ACL: ACL{
+			Entries: []ACLEntry{
+				{ID: "data-read", Subject: Everyone(), PathPattern: "/data/**", Permissions: Read, Effect: Allow, Tags: []string{"data"}},
+				{ID: "data-secret", Subject: Everyone(), PathPattern: "/data/secret/**", Permissions: All, Effect: Deny, Priority: 10, Tags: []string{"data", "secret"}},
+				{Subject: User("alice"), PathPattern: "/home/alice/**", Permissions: All, Effect: Allow},
+			},
+			Default: Deny,
+		},
+		Audit: AuditConfig{
+			Enabled: true,
+			Writer:  io.Discard,
+			Handler: func(event *AuditEvent) { events = append(events, event) },
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+	ctx := WithUser(context.Background(), "alice")
+
+	if rule, ok := pfs.GetRule("data-secret"); !ok || rule.PathPattern != "/data/secret/**" {
+		t.Errorf("GetRule returned %+v, %v", rule, ok)
+	}
+	if _, ok := pfs.GetRule(""); ok {
+		t.Error("GetRule must not match rules without an ID")
+	}
+	if rules := pfs.ListRules("data"); len(rules) != 2 {
+		t.Errorf("expected 2 rules tagged data, got %d", len(rules))
+	}
+	if rules := pfs.ListRules("data", "secret"); len(rules) != 1 || rules[0].ID != "data-secret" {
+		t.Errorf("expected only data-secret, got %v", rules)
+	}
+	if rules := pfs.ListRules(); len(rules) != 3 {
+		t.Errorf("expected all 3 rules, got %d", len(rules))
+	}
+
+	// The deciding rule is reported in the error and the audit event
+	_, err = pfs.OpenFile(ctx, "/data/secret/plans.txt", os.O_RDONLY, 0)
+	var permErr *PermissionError
+	if !errors.As(err, &permErr) || permErr.RuleID != "data-secret" {
+		t.Errorf("expected denial by data-secret, got %v", err)
+	}
+	if len(events) != 1 || events[0].RuleID != "data-secret" {
+		t.Errorf("expected audit event with rule ID, got %+v", events)
+	}
+	if _, err := pfs.OpenFile(ctx, "/data/report.txt", os.O_RDONLY, 0); err != nil {
+		t.Errorf("expected access to be allowed: %v", err)
+	}
+	if events[1].RuleID != "data-read" {
+		t.Errorf("expected allow by data-read, got %q", events[1].RuleID)
+	}
+
+	if err := pfs.AddRule(ACLEntry{ID: "data-read", Subject: Everyone(), PathPattern: "/x", Permissions: Read, Effect: Allow}); !errors.Is(err, ErrDuplicateRuleID) {
+		t.Errorf("expected ErrDuplicateRuleID, got %v", err)
+	}
+
+	if err := pfs.RemoveRuleByID("data-secret"); err != nil {
+		t.Fatalf("RemoveRuleByID failed: %v", err)
+	}
+	if _, ok := pfs.GetRule("data-secret"); ok {
+		t.Error("rule still present after RemoveRuleByID")
+	}
+	if _, err := pfs.OpenFile(ctx, "/data/secret/plans.txt", os.O_RDONLY, 0); err != nil {
+		t.Errorf("expected access to be allowed after removing the deny rule: %v", err)
+	}
+	if err := pfs.RemoveRuleByID("data-secret"); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("expected ErrRuleNotFound, got %v", err)
+	}
+}
+
 func TestNewPermFSNilBase(t *testing.T) {
 	_, err := New(nil, Config{})
 	if err != ErrInvalidConfig {
@@ -802,6 +1102,178 @@ func TestPermFSMkdirAll(t *testing.T) {
 	}
 }
 
+func TestPermFSMkdirAllIntermediate(t *testing.T) {
+	acl := ACL{
+		Entries: []ACLEntry{
+			{
+				Subject:     User("alice"),
+				PathPattern: "/a/b/c/**",
+				Permissions: Write,
+				Effect:      Allow,
+				Priority:    100,
+			},
+			{
+				Subject:     User("alice"),
+				PathPattern: "/home/alice/**",
+				Permissions: Write,
+				Effect:      Allow,
+				Priority:    100,
+			},
+		},
+		Default: Deny,
+	}
+
+	t.Run("missing intermediate directory is refused", func(t *testing.T) {
+		mfs := seedMemFS(t)
+		pfs, _ := New(mfs, Config{ACL: acl})
+		ctx := WithUser(context.Background(), "alice")
+
+		err := pfs.MkdirAll(ctx, "/a/b/c/d", 0755)
+		var permErr *PermissionError
+		if !errors.As(err, &permErr) {
+			t.Fatalf("expected *PermissionError, got %v", err)
+		}
+		if permErr.Path != "/a" {
+			t.Errorf("expected first refused component /a, got %s", permErr.Path)
+		}
+		if !containsString(permErr.Error(), "required to create /a/b/c/d") {
+			t.Errorf("expected reason to name the target, got %s", permErr.Error())
+		}
+		if memExists(mfs, "/a") {
+			t.Error("refused MkdirAll must not create anything")
+		}
+	})
+
+	t.Run("existing ancestors are not checked", func(t *testing.T) {
+		mfs := seedMemFS(t, "/a/b/")
+		pfs, _ := New(mfs, Config{ACL: acl})
+		ctx := WithUser(context.Background(), "alice")
+
+		if err := pfs.MkdirAll(ctx, "/a/b/c/d/e", 0755); err != nil {
+			t.Fatalf("expected MkdirAll to succeed: %v", err)
+		}
+		if !memExists(mfs, "/a/b/c/d/e") {
+			t.Error("expected directories to be created")
+		}
+	})
+
+	t.Run("check parents mode", func(t *testing.T) {
+		mfs := seedMemFS(t, "/home/")
+		pfs, _ := New(mfs, Config{
+			ACL:         acl,
+			Enforcement: EnforcementConfig{MkdirAll: MkdirAllCheckParents},
+		})
+		ctx := WithUser(context.Background(), "alice")
+
+		// Creating /home/alice needs Write on /home
+		err := pfs.MkdirAll(ctx, "/home/alice/docs", 0755)
+		var permErr *PermissionError
+		if !errors.As(err, &permErr) || permErr.Path != "/home" {
+			t.Fatalf("expected denial on /home, got %v", err)
+		}
+
+		mfs.MkdirAll(context.Background(), "/home/alice", 0755)
+		if err := pfs.MkdirAll(ctx, "/home/alice/docs/2024", 0755); err != nil {
+			t.Fatalf("expected MkdirAll to succeed: %v", err)
+		}
+	})
+}
+
+func TestPermFSReadDirListFilter(t *testing.T) {
+	acl := ACL{
+		Entries: []ACLEntry{
+			{
+				Subject:     User("alice"),
+				PathPattern: "/shared",
+				Permissions: Read,
+				Effect:      Allow,
+				Priority:    100,
+			},
+			{
+				Subject:     User("alice"),
+				PathPattern: "/shared/public/**",
+				Permissions: Read | Metadata,
+				Effect:      Allow,
+				Priority:    100,
+			},
+			{
+				Subject:     User("alice"),
+				PathPattern: "/shared/notes.txt",
+				Permissions: Metadata,
+				Effect:      Allow,
+				Priority:    100,
+			},
+		},
+		Default: Deny,
+	}
+	mfs := seedMemFS(t, "/shared/public/", "/shared/private/", "/shared/notes.txt", "/shared/secret.txt")
+	ctx := WithUser(context.Background(), "alice")
+
+	names := func(infos []os.FileInfo) []string {
+		out := make([]string, len(infos))
+		for i, info := range infos {
+			out[i] = info.Name()
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		filter Operation
+		want   []string
+	}{
+		{"no filter", 0, []string{"notes.txt", "private", "public", "secret.txt"}},
+		{"metadata", OperationMetadata, []string{"notes.txt", "public"}},
+		{"read", OperationRead, []string{"public"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pfs, _ := New(mfs, Config{
+				ACL:         acl,
+				Enforcement: EnforcementConfig{ListFilter: tt.filter},
+			})
+			infos, err := pfs.ReadDir(ctx, "/shared")
+			if err != nil {
+				t.Fatalf("ReadDir failed: %v", err)
+			}
+			if got := names(infos); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("hidden entries are audited", func(t *testing.T) {
+		var hidden []string
+		level := AuditLevelDenied
+		pfs, _ := New(mfs, Config{
+			ACL:         acl,
+			Enforcement: EnforcementConfig{ListFilter: OperationMetadata},
+			Audit: AuditConfig{
+				Enabled: true,
+				Level:   &level,
+				Writer:  io.Discard,
+				Handler: func(event *AuditEvent) { hidden = append(hidden, event.Path) },
+			},
+		})
+		if _, err := pfs.ReadDir(ctx, "/shared"); err != nil {
+			t.Fatalf("ReadDir failed: %v", err)
+		}
+		if want := []string{"/shared/private", "/shared/secret.txt"}; !reflect.DeepEqual(hidden, want) {
+			t.Errorf("expected denied events for %v, got %v", want, hidden)
+		}
+	})
+
+	t.Run("missing identity is an error", func(t *testing.T) {
+		pfs, _ := New(mfs, Config{
+			ACL:         acl,
+			Enforcement: EnforcementConfig{ListFilter: OperationMetadata},
+		})
+		if _, err := pfs.listingFilter(context.Background(), "/shared"); !errors.Is(err, ErrNoIdentity) {
+			t.Errorf("expected ErrNoIdentity, got %v", err)
+		}
+	})
+}
+
 func TestPermFSRemoveAll(t *testing.T) {
 	mock := &mockFileSystem{}
 	acl := ACL{
@@ -838,6 +1310,135 @@ func TestPermFSRemoveAll(t *testing.T) {
 	}
 }
 
+func TestPermFSRemoveAllRecursive(t *testing.T) {
+	acl := ACL{
+		Entries: []ACLEntry{
+			{
+				Subject:     User("alice"),
+				PathPattern: "/projects/**",
+				Permissions: Delete,
+				Effect:      Allow,
+				Priority:    10,
+			},
+			{
+				Subject:     Everyone(),
+				PathPattern: "/projects/secret/**",
+				Permissions: Delete,
+				Effect:      Deny,
+				Priority:    100,
+			},
+		},
+		Default: Deny,
+	}
+	files := []string{
+		"/projects/readme.txt",
+		"/projects/app/main.go",
+		"/projects/secret/keys.txt",
+		"/projects/secret/nested/more.txt",
+	}
+
+	t.Run("check root only deletes everything", func(t *testing.T) {
+		mfs := seedMemFS(t, files...)
+		pfs, _ := New(mfs, Config{ACL: acl})
+		ctx := WithUser(context.Background(), "alice")
+
+		if err := pfs.RemoveAll(ctx, "/projects"); err != nil {
+			t.Fatalf("expected legacy RemoveAll to succeed: %v", err)
+		}
+		if memExists(mfs, "/projects/secret/keys.txt") {
+			t.Error("expected legacy mode to delete the protected subtree")
+		}
+	})
+
+	t.Run("preflight refuses the whole operation", func(t *testing.T) {
+		mfs := seedMemFS(t, files...)
+		pfs, _ := New(mfs, Config{
+			ACL:         acl,
+			Enforcement: EnforcementConfig{RemoveAll: RemoveAllPreflight},
+		})
+		ctx := WithUser(context.Background(), "alice")
+
+		err := pfs.RemoveAll(ctx, "/projects")
+		if !IsPermissionDenied(err) {
+			t.Fatalf("expected permission denied, got %v", err)
+		}
+		var multiErr *MultiPathError
+		if !errors.As(err, &multiErr) {
+			t.Fatalf("expected *MultiPathError, got %T", err)
+		}
+		expected := []string{"/projects/secret", "/projects/secret/keys.txt", "/projects/secret/nested", "/projects/secret/nested/more.txt"}
+		denied := multiErr.DeniedPaths()
+		if len(denied) != len(expected) {
+			t.Fatalf("expected denied %v, got %v", expected, denied)
+		}
+		for i := range expected {
+			if denied[i] != expected[i] {
+				t.Errorf("denied[%d]: expected %s, got %s", i, expected[i], denied[i])
+			}
+		}
+		for _, f := range files {
+			if !memExists(mfs, f) {
+				t.Errorf("preflight must not delete anything, %s is gone", f)
+			}
+		}
+
+		if err := pfs.RemoveAll(ctx, "/projects/app"); err != nil {
+			t.Errorf("expected unprotected subtree removal to succeed: %v", err)
+		}
+		if memExists(mfs, "/projects/app") {
+			t.Error("expected /projects/app to be removed")
+		}
+		if err := pfs.RemoveAll(ctx, "/projects/missing"); err != nil {
+			t.Errorf("expected RemoveAll of missing path to succeed: %v", err)
+		}
+	})
+
+	t.Run("partial deletes only permitted paths", func(t *testing.T) {
+		mfs := seedMemFS(t, files...)
+		pfs, _ := New(mfs, Config{
+			ACL:         acl,
+			Enforcement: EnforcementConfig{RemoveAll: RemoveAllPartial},
+		})
+		ctx := WithUser(context.Background(), "alice")
+
+		err := pfs.RemoveAll(ctx, "/projects")
+		var multiErr *MultiPathError
+		if !errors.As(err, &multiErr) {
+			t.Fatalf("expected *MultiPathError, got %v", err)
+		}
+		if len(multiErr.Denied) != 4 {
+			t.Errorf("expected 4 denied paths, got %v", multiErr.DeniedPaths())
+		}
+		if memExists(mfs, "/projects/readme.txt") || memExists(mfs, "/projects/app") {
+			t.Error("expected permitted paths to be removed")
+		}
+		if !memExists(mfs, "/projects/secret/keys.txt") || !memExists(mfs, "/projects/secret/nested/more.txt") {
+			t.Error("expected protected paths to survive")
+		}
+		if !memExists(mfs, "/projects") {
+			t.Error("expected parent of protected paths to survive")
+		}
+	})
+
+	t.Run("root denial still wins", func(t *testing.T) {
+		mfs := seedMemFS(t, files...)
+		pfs, _ := New(mfs, Config{
+			ACL:         acl,
+			Enforcement: EnforcementConfig{RemoveAll: RemoveAllPartial},
+		})
+		ctx := WithUser(context.Background(), "alice")
+
+		err := pfs.RemoveAll(ctx, "/projects/secret")
+		var permErr *PermissionError
+		if !errors.As(err, &permErr) {
+			t.Fatalf("expected *PermissionError, got %v", err)
+		}
+		if !memExists(mfs, "/projects/secret/keys.txt") {
+			t.Error("expected nothing to be removed")
+		}
+	})
+}
+
 func TestPermFSLstat(t *testing.T) {
 	mock := &mockFileSystem{}
 	acl := ACL{
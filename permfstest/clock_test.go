@@ -0,0 +1,22 @@
+package permfstest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	if !clock.Now().Equal(start) {
+		t.Errorf("expected %v, got %v", start, clock.Now())
+	}
+	if got := clock.Advance(90 * time.Minute); !got.Equal(start.Add(90*time.Minute)) || !clock.Now().Equal(got) {
+		t.Errorf("Advance returned %v, Now is %v", got, clock.Now())
+	}
+	clock.Set(start)
+	if !clock.Now().Equal(start) {
+		t.Errorf("expected Set to move the clock back to %v, got %v", start, clock.Now())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -17,23 +18,38 @@ const (
 	PolicyFormatJSON PolicyFormat = iota
 	// PolicyFormatYAML represents YAML format
 	PolicyFormatYAML
+	// PolicyFormatText represents the line-oriented text format parsed by ParsePolicyText
+	PolicyFormatText
 )
 
-// PolicyFile represents a serializable policy
+// PolicyFile represents a serializable policy.
+// Include, Layer and Layers are only interpreted by LoadPolicyTree.
 type PolicyFile struct {
 	Version     string              `json:"version" yaml:"version"`
 	Description string              `json:"description,omitempty" yaml:"description,omitempty"`
 	Default     string              `json:"default" yaml:"default"`
+	Combining   string              `json:"combining,omitempty" yaml:"combining,omitempty"`
+	Include     []string            `json:"include,omitempty" yaml:"include,omitempty"`
+	Layers      []PolicyLayer       `json:"layers,omitempty" yaml:"layers,omitempty"`
+	Layer       string              `json:"layer,omitempty" yaml:"layer,omitempty"`
 	Entries     []PolicyEntryExport `json:"entries" yaml:"entries"`
 }
 
 // PolicyEntryExport represents a serializable ACL entry
 type PolicyEntryExport struct {
-	Subject     SubjectExport `json:"subject" yaml:"subject"`
-	PathPattern string        `json:"path_pattern" yaml:"path_pattern"`
-	Permissions []string      `json:"permissions" yaml:"permissions"`
-	Effect      string        `json:"effect" yaml:"effect"`
-	Priority    int           `json:"priority" yaml:"priority"`
+	ID          string            `json:"id,omitempty" yaml:"id,omitempty"`
+	Name        string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Subject     SubjectExport     `json:"subject" yaml:"subject"`
+	PathPattern string            `json:"path_pattern" yaml:"path_pattern"`
+	Permissions []string          `json:"permissions" yaml:"permissions"`
+	Effect      string            `json:"effect" yaml:"effect"`
+	Priority    int               `json:"priority" yaml:"priority"`
+	Conceal     bool              `json:"conceal,omitempty" yaml:"conceal,omitempty"`
+	Conditions  []ConditionExport `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+	NotBefore   *time.Time        `json:"not_before,omitempty" yaml:"not_before,omitempty"`
+	NotAfter    *time.Time        `json:"not_after,omitempty" yaml:"not_after,omitempty"`
 }
 
 // SubjectExport represents a serializable subject
@@ -42,17 +58,44 @@ type SubjectExport struct {
 	ID   string `json:"id" yaml:"id"`
 }
 
-// ExportPolicy exports an ACL to a policy file format
+// ExportPolicy exports an ACL to a policy file format.
+// Conditions of types unknown to this package are exported as references to a
+// registered condition named after their String() representation; use
+// ExportPolicyStrict to reject them instead.
 func ExportPolicy(acl ACL, description string) *PolicyFile {
+	policy, _ := exportPolicy(acl, description, false)
+	return policy
+}
+
+// ExportPolicyStrict exports an ACL to a policy file format.
+// It fails with ErrUnsupportedCondition if an entry has a condition that
+// cannot be written to a policy file.
+func ExportPolicyStrict(acl ACL, description string) (*PolicyFile, error) {
+	return exportPolicy(acl, description, true)
+}
+
+// exportPolicy exports an ACL, failing on unknown condition types when strict is set
+func exportPolicy(acl ACL, description string, strict bool) (*PolicyFile, error) {
 	policy := &PolicyFile{
 		Version:     "1.0",
 		Description: description,
 		Default:     effectToString(acl.Default),
 		Entries:     make([]PolicyEntryExport, len(acl.Entries)),
 	}
+	if acl.Combining != CombinePriority {
+		policy.Combining = acl.Combining.String()
+	}
 
 	for i, entry := range acl.Entries {
+		conditions, err := exportConditions(entry.Conditions, strict)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
 		policy.Entries[i] = PolicyEntryExport{
+			ID:          entry.ID,
+			Name:        entry.Name,
+			Description: entry.Description,
+			Tags:        entry.Tags,
 			Subject: SubjectExport{
 				Type: subjectTypeToString(entry.Subject.Type),
 				ID:   entry.Subject.ID,
@@ -61,10 +104,14 @@ func ExportPolicy(acl ACL, description string) *PolicyFile {
 			Permissions: operationsToStrings(entry.Permissions),
 			Effect:      effectToString(entry.Effect),
 			Priority:    entry.Priority,
+			Conceal:     entry.Conceal,
+			Conditions:  conditions,
+			NotBefore:   exportTime(entry.NotBefore),
+			NotAfter:    exportTime(entry.NotAfter),
 		}
 	}
 
-	return policy
+	return policy, nil
 }
 
 // ImportPolicy imports a policy file into an ACL
@@ -80,6 +127,12 @@ func ImportPolicy(policy *PolicyFile) (ACL, error) {
 	}
 	acl.Default = defaultEffect
 
+	combining, err := ParseCombiningAlgorithm(policy.Combining)
+	if err != nil {
+		return acl, err
+	}
+	acl.Combining = combining
+
 	// Parse entries
 	for i, entry := range policy.Entries {
 		subjectType, err := stringToSubjectType(entry.Subject.Type)
@@ -97,7 +150,16 @@ func ImportPolicy(policy *PolicyFile) (ACL, error) {
 			return acl, fmt.Errorf("entry %d: invalid effect: %w", i, err)
 		}
 
+		conditions, err := importConditions(entry.Conditions)
+		if err != nil {
+			return acl, fmt.Errorf("entry %d: invalid conditions: %w", i, err)
+		}
+
 		acl.Entries[i] = ACLEntry{
+			ID:          entry.ID,
+			Name:        entry.Name,
+			Description: entry.Description,
+			Tags:        entry.Tags,
 			Subject: Subject{
 				Type: subjectType,
 				ID:   entry.Subject.ID,
@@ -106,6 +168,14 @@ func ImportPolicy(policy *PolicyFile) (ACL, error) {
 			Permissions: permissions,
 			Effect:      effect,
 			Priority:    entry.Priority,
+			Conceal:     entry.Conceal,
+			Conditions:  conditions,
+		}
+		if entry.NotBefore != nil {
+			acl.Entries[i].NotBefore = *entry.NotBefore
+		}
+		if entry.NotAfter != nil {
+			acl.Entries[i].NotAfter = *entry.NotAfter
 		}
 	}
 
@@ -134,6 +204,13 @@ func SavePolicy(policy *PolicyFile, w io.Writer, format PolicyFormat) error {
 		encoder := yaml.NewEncoder(w)
 		defer encoder.Close()
 		return encoder.Encode(policy)
+	case PolicyFormatText:
+		text, err := formatPolicyText(policy)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, text)
+		return err
 	default:
 		return fmt.Errorf("unsupported format: %d", format)
 	}
@@ -165,6 +242,8 @@ func LoadPolicy(r io.Reader, format PolicyFormat) (*PolicyFile, error) {
 		if err := decoder.Decode(policy); err != nil {
 			return nil, err
 		}
+	case PolicyFormatText:
+		return readPolicyText(r)
 	default:
 		return nil, fmt.Errorf("unsupported format: %d", format)
 	}
@@ -174,6 +253,14 @@ func LoadPolicy(r io.Reader, format PolicyFormat) (*PolicyFile, error) {
 
 // Helper conversion functions
 
+// exportTime returns nil for the zero time so that it is omitted
+func exportTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 func effectToString(effect Effect) string {
 	if effect == EffectAllow {
 		return "allow"
@@ -0,0 +1,362 @@
+package permfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyLayer defines a named group of rules whose priorities are shifted by Offset.
+// Rule priorities within the layer are capped at a ceiling before the offset is
+// added, so a layer can never outrank a layer with a higher Offset. The ceiling
+// defaults to just below the next layer's Offset; a positive Ceiling may lower it
+// but not raise it. The layer with the highest Offset is uncapped unless Ceiling
+// is set.
+type PolicyLayer struct {
+	Name    string `json:"name" yaml:"name"`
+	Offset  int    `json:"offset" yaml:"offset"`
+	Ceiling int    `json:"ceiling,omitempty" yaml:"ceiling,omitempty"`
+}
+
+// PolicySource records where an ACL entry of a merged policy was defined
+type PolicySource struct {
+	// File is the absolute path of the policy file
+	File string
+	// Line is the 1-based line of the entry within File
+	Line int
+	// Layer is the layer the entry belongs to, if any
+	Layer string
+}
+
+// String returns "file:line"
+func (ps PolicySource) String() string {
+	return fmt.Sprintf("%s:%d", ps.File, ps.Line)
+}
+
+// SourcedEntry is an ACL entry together with where it was defined
+type SourcedEntry struct {
+	Entry  ACLEntry
+	Source PolicySource
+}
+
+// MergedPolicy is the result of loading a policy file and everything it includes
+type MergedPolicy struct {
+	// ACL is the combined ACL with layer offsets applied
+	ACL ACL
+	// Sources holds the origin of each entry in ACL.Entries, by index
+	Sources []PolicySource
+	// Files lists every loaded file in load order
+	Files []string
+}
+
+// EffectiveRules returns the entries whose pattern matches path, with their origin
+func (mp *MergedPolicy) EffectiveRules(path string) []SourcedEntry {
+	cleanPath := normalizePatternPath(path)
+	var result []SourcedEntry
+	for i, entry := range mp.ACL.Entries {
+		if compilePattern(entry.PathPattern).matchClean(cleanPath) {
+			result = append(result, SourcedEntry{Entry: entry, Source: mp.Sources[i]})
+		}
+	}
+	return result
+}
+
+// LoadPolicyTree loads a policy file together with the files it includes and merges them.
+//
+// Include paths are relative to the including file, and each file is loaded at most
+// once; an include cycle is an error. Included files are merged before the entries of
+// the file that includes them. The format of an included file is taken from its
+// extension (.json, .yaml, .yml, .policy), falling back to format.
+//
+// A file's entries belong to the layer it names, or to its includer's layer if it
+// names none. Layers may only be defined in the root file, and an included file
+// may not name a layer with a higher offset than its includer's, so an include
+// can never place its rules above the layer it was included into. The default
+// effect and combining algorithm come from the root file.
+// The merged ACL is validated with ValidateACL.
+func LoadPolicyTree(filename string, format PolicyFormat) (*MergedPolicy, error) {
+	merged, _, err := loadPolicyTree(filename, format)
+	return merged, err
+}
+
+// loadPolicyTree is LoadPolicyTree, but also returns the files it read or tried
+// to read, including when loading fails
+func loadPolicyTree(filename string, format PolicyFormat) (*MergedPolicy, []string, error) {
+	loader := &policyLoader{
+		layers: make(map[string]PolicyLayer),
+		loaded: make(map[string]bool),
+		merged: &MergedPolicy{},
+	}
+
+	root, err := loader.load(filename, format, "", nil)
+	if err != nil {
+		return nil, loader.merged.Files, err
+	}
+	defaultEffect, err := stringToEffect(root.Default)
+	if err != nil {
+		return nil, loader.merged.Files, fmt.Errorf("%s: invalid default effect: %w", filename, err)
+	}
+	loader.merged.ACL.Default = defaultEffect
+	if loader.merged.ACL.Combining, err = ParseCombiningAlgorithm(root.Combining); err != nil {
+		return nil, loader.merged.Files, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	// Apply layer offsets once every definition is known
+	ceilings, err := layerCeilings(loader.layers)
+	if err != nil {
+		return nil, loader.merged.Files, fmt.Errorf("%s: %w", filename, err)
+	}
+	for i := range loader.merged.ACL.Entries {
+		name := loader.merged.Sources[i].Layer
+		if name == "" {
+			continue
+		}
+		layer, ok := loader.layers[name]
+		if !ok {
+			return nil, loader.merged.Files, fmt.Errorf("%s: undefined layer %q", loader.merged.Sources[i], name)
+		}
+		entry := &loader.merged.ACL.Entries[i]
+		if ceiling, ok := ceilings[name]; ok && entry.Priority > ceiling {
+			entry.Priority = ceiling
+		}
+		entry.Priority += layer.Offset
+	}
+
+	if result := ValidateACL(loader.merged.ACL); !result.Valid {
+		messages := make([]string, len(result.Errors))
+		for i, ve := range result.Errors {
+			messages[i] = ve.Error()
+		}
+		return nil, loader.merged.Files, fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(messages, "; "))
+	}
+	return loader.merged, loader.merged.Files, nil
+}
+
+// layerCeilings returns the priority cap of each capped layer: its Ceiling if
+// set, or the room below the next higher layer's Offset
+func layerCeilings(layers map[string]PolicyLayer) (map[string]int, error) {
+	ordered := make([]PolicyLayer, 0, len(layers))
+	for _, layer := range layers {
+		ordered = append(ordered, layer)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].Offset != ordered[j].Offset {
+			return ordered[i].Offset < ordered[j].Offset
+		}
+		return ordered[i].Name < ordered[j].Name
+	})
+
+	ceilings := make(map[string]int, len(ordered))
+	for i, layer := range ordered {
+		next := i + 1
+		for next < len(ordered) && ordered[next].Offset == layer.Offset {
+			next++
+		}
+		switch {
+		case next < len(ordered) && layer.Ceiling > ordered[next].Offset-layer.Offset-1:
+			return nil, fmt.Errorf("%w: layer %q ceiling %d lets it outrank layer %q",
+				ErrInvalidConfig, layer.Name, layer.Ceiling, ordered[next].Name)
+		case layer.Ceiling > 0:
+			ceilings[layer.Name] = layer.Ceiling
+		case next < len(ordered):
+			ceilings[layer.Name] = ordered[next].Offset - layer.Offset - 1
+		}
+	}
+	return ceilings, nil
+}
+
+// policyLoader accumulates the files of a policy tree
+type policyLoader struct {
+	layers map[string]PolicyLayer
+	loaded map[string]bool
+	merged *MergedPolicy
+}
+
+// load reads one file, recursing into its includes. stack holds the files that
+// include it, outermost first.
+func (pl *policyLoader) load(filename string, format PolicyFormat, layer string, stack []string) (*PolicyFile, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	pl.loaded[abs] = true
+	pl.merged.Files = append(pl.merged.Files, abs)
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	policy, lines, err := decodePolicyWithLines(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", abs, err)
+	}
+
+	if len(stack) > 0 && len(policy.Layers) > 0 {
+		return nil, fmt.Errorf("%w: %s: layers may only be defined in the root policy", ErrInvalidConfig, abs)
+	}
+	for _, def := range policy.Layers {
+		if existing, ok := pl.layers[def.Name]; ok && existing != def {
+			return nil, fmt.Errorf("%s: layer %q redefined with different settings", abs, def.Name)
+		}
+		pl.layers[def.Name] = def
+	}
+	if policy.Layer != "" {
+		current, inLayer := pl.layers[layer]
+		if named, ok := pl.layers[policy.Layer]; ok && inLayer && named.Offset > current.Offset {
+			return nil, fmt.Errorf("%w: %s: layer %q outranks layer %q it is included into",
+				ErrInvalidConfig, abs, policy.Layer, layer)
+		}
+		layer = policy.Layer
+	}
+
+	stack = append(stack, abs)
+	for _, include := range policy.Include {
+		path := include
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(abs), path)
+		}
+		path = filepath.Clean(path)
+		for _, f := range stack {
+			if f == path {
+				return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack, path), " -> "))
+			}
+		}
+		if pl.loaded[path] {
+			continue
+		}
+		if _, err := pl.load(path, policyFormatForFile(path, format), layer, stack); err != nil {
+			return nil, err
+		}
+	}
+
+	acl, err := ImportPolicy(&PolicyFile{Default: "deny", Entries: policy.Entries})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", abs, err)
+	}
+	for i, entry := range acl.Entries {
+		pl.merged.ACL.Entries = append(pl.merged.ACL.Entries, entry)
+		pl.merged.Sources = append(pl.merged.Sources, PolicySource{File: abs, Line: lines[i], Layer: layer})
+	}
+	return policy, nil
+}
+
+// policyFormatForFile picks a format from the file extension
+func policyFormatForFile(filename string, fallback PolicyFormat) PolicyFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return PolicyFormatJSON
+	case ".yaml", ".yml":
+		return PolicyFormatYAML
+	case ".policy":
+		return PolicyFormatText
+	default:
+		return fallback
+	}
+}
+
+// decodePolicyWithLines decodes a policy and returns the line on which each entry starts
+func decodePolicyWithLines(data []byte, format PolicyFormat) (*PolicyFile, []int, error) {
+	if format == PolicyFormatText {
+		return parsePolicyTextLines(string(data))
+	}
+
+	policy, err := LoadPolicy(bytes.NewReader(data), format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var lines []int
+	switch format {
+	case PolicyFormatJSON:
+		lines, err = jsonEntryLines(data)
+	case PolicyFormatYAML:
+		lines, err = yamlEntryLines(data)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(lines) != len(policy.Entries) {
+		return nil, nil, fmt.Errorf("could not locate policy entries")
+	}
+	return policy, lines, nil
+}
+
+// jsonEntryLines finds the line of each element of the top-level "entries" array
+func jsonEntryLines(data []byte) ([]int, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+
+	var lines []int
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		// Keys match fields case-insensitively, as in json.Unmarshal, and the last one wins
+		if name, _ := key.(string); !strings.EqualFold(name, "entries") {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		lines = nil
+		if tok, err := dec.Token(); err != nil {
+			return nil, err
+		} else if tok == nil {
+			continue
+		} else if tok != json.Delim('[') {
+			return nil, fmt.Errorf("entries must be an array")
+		}
+		for dec.More() {
+			// InputOffset is just past the previous token; skip to the element itself
+			offset := int(dec.InputOffset())
+			for offset < len(data) && strings.ContainsRune(" \t\r\n,", rune(data[offset])) {
+				offset++
+			}
+			lines = append(lines, bytes.Count(data[:offset], []byte("\n"))+1)
+
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+	return lines, nil
+}
+
+// yamlEntryLines finds the line of each element of the top-level "entries" sequence
+func yamlEntryLines(data []byte) ([]int, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	mapping := doc.Content[0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != "entries" {
+			continue
+		}
+		var lines []int
+		for _, item := range mapping.Content[i+1].Content {
+			lines = append(lines, item.Line)
+		}
+		return lines, nil
+	}
+	return nil, nil
+}
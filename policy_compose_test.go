@@ -0,0 +1,311 @@
+package permfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePolicyFiles creates files under a temporary directory and returns the directory
+func writePolicyFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		full := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadPolicyTree(t *testing.T) {
+	dir := writePolicyFiles(t, map[string]string{
+		"org.yaml": `version: "1.0"
+default: deny
+layers:
+  - name: org
+    offset: 10000
+  - name: team
+    offset: 1000
+    ceiling: 999
+layer: org
+include:
+  - teams/eng.policy
+entries:
+  - subject: {type: everyone, id: "*"}
+    path_pattern: /prod/**
+    permissions: [write, delete]
+    effect: deny
+    priority: 0
+`,
+		"teams/eng.policy": `# Engineering
+layer team
+include ../common.json
+
+allow group:eng all /prod/** priority 50000
+allow group:eng read,write /projects/** priority 10
+`,
+		"common.json": `{
+  "version": "1.0",
+  "default": "allow",
+  "entries": [
+    {"subject": {"type": "everyone", "id": "*"}, "path_pattern": "/public/**", "permissions": ["read"], "effect": "allow", "priority": 1}
+  ]
+}`,
+	})
+
+	merged, err := LoadPolicyTree(filepath.Join(dir, "org.yaml"), PolicyFormatYAML)
+	if err != nil {
+		t.Fatalf("LoadPolicyTree failed: %v", err)
+	}
+	if merged.ACL.Default != Deny {
+		t.Error("expected the root file's default")
+	}
+	if len(merged.Files) != 3 || len(merged.ACL.Entries) != 4 {
+		t.Fatalf("unexpected merge: files=%v entries=%d", merged.Files, len(merged.ACL.Entries))
+	}
+
+	// Includes come first, then the including file's own entries
+	want := []struct {
+		file     string
+		line     int
+		layer    string
+		priority int
+	}{
+		{"common.json", 5, "team", 1001},
+		{"eng.policy", 5, "team", 1999},
+		{"eng.policy", 6, "team", 1010},
+		{"org.yaml", 13, "org", 10000},
+	}
+	for i, w := range want {
+		src := merged.Sources[i]
+		if filepath.Base(src.File) != w.file || src.Line != w.line || src.Layer != w.layer {
+			t.Errorf("entry %d: expected %s:%d in %s, got %s in %s", i, w.file, w.line, w.layer, src, src.Layer)
+		}
+		if got := merged.ACL.Entries[i].Priority; got != w.priority {
+			t.Errorf("entry %d: expected priority %d, got %d", i, w.priority, got)
+		}
+	}
+
+	// The team layer cannot outrank the org-wide deny
+	evaluator := NewEvaluator(merged.ACL)
+	eng := &Identity{UserID: "bob", Groups: []string{"eng"}}
+	if evaluator.CanWrite(eng, "/prod/app.conf") {
+		t.Error("team rule must not outrank the org deny")
+	}
+	if !evaluator.CanRead(eng, "/prod/app.conf") {
+		t.Error("expected team read on /prod")
+	}
+
+	rules := merged.EffectiveRules("/prod/app.conf")
+	if len(rules) != 2 || filepath.Base(rules[1].Source.File) != "org.yaml" {
+		t.Errorf("unexpected effective rules: %v", rules)
+	}
+}
+
+func TestLoadPolicyTreeDerivedCeiling(t *testing.T) {
+	dir := writePolicyFiles(t, map[string]string{
+		"root.policy": `define layer org offset 1000
+define layer team offset 0
+include team.policy
+
+layer org
+deny everyone write /prod/**
+`,
+		"team.policy": `layer team
+allow group:eng write /prod/** priority 5000
+`,
+	})
+
+	merged, err := LoadPolicyTree(filepath.Join(dir, "root.policy"), PolicyFormatText)
+	if err != nil {
+		t.Fatalf("LoadPolicyTree failed: %v", err)
+	}
+	if got := merged.ACL.Entries[0].Priority; got != 999 {
+		t.Errorf("expected the team rule capped below the org layer, got priority %d", got)
+	}
+	if got := merged.ACL.Entries[1].Priority; got != 1000 {
+		t.Errorf("expected the top layer to be uncapped, got priority %d", got)
+	}
+	eng := &Identity{UserID: "bob", Groups: []string{"eng"}}
+	if NewEvaluator(merged.ACL).CanWrite(eng, "/prod/app.conf") {
+		t.Error("team rule must not outrank the org deny")
+	}
+}
+
+func TestLoadPolicyTreeIncludeCannotOutrank(t *testing.T) {
+	files := map[string]string{
+		"root.policy": `define layer org offset 10000
+define layer team offset 1000
+layer org
+include team.policy
+
+deny everyone write /prod/**
+`,
+		"team.policy": `layer team
+include extra.policy
+
+allow group:eng read /prod/**
+`,
+	}
+	tests := []struct {
+		name  string
+		extra string
+		want  string
+	}{
+		{
+			name:  "defines a higher layer",
+			extra: "define layer override offset 100000\nlayer override\nallow group:eng write /prod/**\n",
+			want:  "layers may only be defined in the root policy",
+		},
+		{
+			name:  "names the org layer",
+			extra: "layer org\nallow group:eng write /prod/** priority 50000\n",
+			want:  `layer "org" outranks layer "team"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files["extra.policy"] = tt.extra
+			dir := writePolicyFiles(t, files)
+			_, err := LoadPolicyTree(filepath.Join(dir, "root.policy"), PolicyFormatText)
+			if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected ErrInvalidConfig containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Staying in the team layer, or moving below it, is fine
+	files["extra.policy"] = "allow group:eng write /prod/** priority 50000\n"
+	dir := writePolicyFiles(t, files)
+	merged, err := LoadPolicyTree(filepath.Join(dir, "root.policy"), PolicyFormatText)
+	if err != nil {
+		t.Fatalf("LoadPolicyTree failed: %v", err)
+	}
+	eng := &Identity{UserID: "bob", Groups: []string{"eng"}}
+	if NewEvaluator(merged.ACL).CanWrite(eng, "/prod/app.conf") {
+		t.Error("team rule must not outrank the org deny")
+	}
+}
+
+func TestLoadPolicyTreeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"root.policy": "include a.policy\n",
+				"a.policy":    "include b/b.policy\n",
+				"b/b.policy":  "include ../a.policy\n",
+			},
+			want: "include cycle",
+		},
+		{
+			name: "undefined layer",
+			files: map[string]string{
+				"root.policy": "layer missing\nallow user:a read /x\n",
+			},
+			want: `undefined layer "missing"`,
+		},
+		{
+			name: "conflicting layer definitions",
+			files: map[string]string{
+				"root.policy": "define layer org offset 100\ndefine layer org offset 200\n",
+			},
+			want: "redefined",
+		},
+		{
+			name: "layer defined in include",
+			files: map[string]string{
+				"root.policy": "define layer org offset 100\ninclude a.policy\n",
+				"a.policy":    "define layer org offset 200\n",
+			},
+			want: "layers may only be defined in the root policy",
+		},
+		{
+			name: "ceiling above the next layer",
+			files: map[string]string{
+				"root.policy": "define layer org offset 1000\ndefine layer team offset 0 ceiling 1000\n",
+			},
+			want: `layer "team" ceiling 1000 lets it outrank layer "org"`,
+		},
+		{
+			name: "missing include",
+			files: map[string]string{
+				"root.policy": "include nowhere.policy\n",
+			},
+			want: "nowhere.policy",
+		},
+		{
+			name: "syntax error in include",
+			files: map[string]string{
+				"root.policy": "include a.policy\n",
+				"a.policy":    "allow user:a fly /x\n",
+			},
+			want: "a.policy: line 1, column 14",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePolicyFiles(t, tt.files)
+			_, err := LoadPolicyTree(filepath.Join(dir, "root.policy"), PolicyFormatText)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadPolicyTreeDiamond(t *testing.T) {
+	dir := writePolicyFiles(t, map[string]string{
+		"root.policy":   "include a.policy\ninclude b.policy\n",
+		"a.policy":      "include shared.policy\n",
+		"b.policy":      "include shared.policy\n",
+		"shared.policy": "allow user:a read /x\n",
+	})
+	merged, err := LoadPolicyTree(filepath.Join(dir, "root.policy"), PolicyFormatText)
+	if err != nil {
+		t.Fatalf("LoadPolicyTree failed: %v", err)
+	}
+	if len(merged.ACL.Entries) != 1 {
+		t.Errorf("expected a file included twice to be loaded once, got %d entries", len(merged.ACL.Entries))
+	}
+}
+
+func TestLoadPolicyTreeJSONEntriesKeyCase(t *testing.T) {
+	dir := writePolicyFiles(t, map[string]string{
+		"root.json": `{
+  "default": "deny",
+  "entries": [
+    {"subject": {"type": "user", "id": "a"}, "path_pattern": "/old", "permissions": ["read"], "effect": "allow"}
+  ],
+  "Entries": [
+
+    {"subject": {"type": "user", "id": "a"}, "path_pattern": "/x", "permissions": ["read"], "effect": "allow"},
+    {"subject": {"type": "user", "id": "a"}, "path_pattern": "/y", "permissions": ["read"], "effect": "allow"}
+  ]
+}
+`,
+	})
+	merged, err := LoadPolicyTree(filepath.Join(dir, "root.json"), PolicyFormatJSON)
+	if err != nil {
+		t.Fatalf("LoadPolicyTree failed: %v", err)
+	}
+	if len(merged.ACL.Entries) != 2 {
+		t.Fatalf("expected the last entries key to win, got %d entries", len(merged.ACL.Entries))
+	}
+	for i, want := range []int{8, 9} {
+		if got := merged.Sources[i].Line; got != want {
+			t.Errorf("entry %d (%s): expected line %d, got %d", i, merged.ACL.Entries[i].PathPattern, want, got)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package permfs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Condition types used in policy files
+const (
+	conditionTypeTime     = "time"
+	conditionTypeIP       = "ip"
+	conditionTypeMetadata = "metadata"
+	conditionTypeFunc     = "func"
+	conditionTypeAnd      = "and"
+	conditionTypeOr       = "or"
+	conditionTypeNot      = "not"
+)
+
+// ConditionExport represents a serializable condition.
+// Type selects which of the remaining fields are used:
+//   - "time": Hours, Days and Timezone (an IANA name such as "Europe/Berlin")
+//   - "ip": Allow and Deny (CIDR ranges)
+//   - "metadata": Key, Values and CaseSensitive
+//   - "func": Name of a condition registered with RegisterCondition
+//   - "and", "or": Conditions
+//   - "not": Conditions, which must hold exactly one condition
+type ConditionExport struct {
+	Type          string            `json:"type" yaml:"type"`
+	Hours         []HourRangeExport `json:"hours,omitempty" yaml:"hours,omitempty"`
+	Days          []string          `json:"days,omitempty" yaml:"days,omitempty"`
+	Timezone      string            `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+	Allow         []string          `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny          []string          `json:"deny,omitempty" yaml:"deny,omitempty"`
+	Key           string            `json:"key,omitempty" yaml:"key,omitempty"`
+	Values        []string          `json:"values,omitempty" yaml:"values,omitempty"`
+	CaseSensitive bool              `json:"case_sensitive,omitempty" yaml:"case_sensitive,omitempty"`
+	Name          string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Conditions    []ConditionExport `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+// HourRangeExport represents a serializable hour range
+type HourRangeExport struct {
+	Start int `json:"start" yaml:"start"`
+	End   int `json:"end" yaml:"end"`
+}
+
+// conditionRegistry holds the named conditions that policy files can reference
+var conditionRegistry = struct {
+	mu    sync.RWMutex
+	funcs map[string]CustomConditionFunc
+}{funcs: make(map[string]CustomConditionFunc)}
+
+// RegisterCondition registers fn under name so that policy files can reference it
+// with a condition of type "func". Registering a name again replaces the function.
+// The returned FuncCondition can be used directly in ACL entries.
+func RegisterCondition(name string, fn CustomConditionFunc) *FuncCondition {
+	conditionRegistry.mu.Lock()
+	defer conditionRegistry.mu.Unlock()
+	conditionRegistry.funcs[name] = fn
+	return NewFuncCondition(name, fn)
+}
+
+// UnregisterCondition removes a named condition from the registry
+func UnregisterCondition(name string) {
+	conditionRegistry.mu.Lock()
+	defer conditionRegistry.mu.Unlock()
+	delete(conditionRegistry.funcs, name)
+}
+
+// LookupCondition returns the function registered under name
+func LookupCondition(name string) (CustomConditionFunc, bool) {
+	conditionRegistry.mu.RLock()
+	defer conditionRegistry.mu.RUnlock()
+	fn, ok := conditionRegistry.funcs[name]
+	return fn, ok
+}
+
+// exportConditions converts conditions to their serializable form
+func exportConditions(conds []Condition, strict bool) ([]ConditionExport, error) {
+	if len(conds) == 0 {
+		return nil, nil
+	}
+	result := make([]ConditionExport, len(conds))
+	for i, cond := range conds {
+		export, err := exportCondition(cond, strict)
+		if err != nil {
+			return nil, fmt.Errorf("condition %d: %w", i, err)
+		}
+		result[i] = export
+	}
+	return result, nil
+}
+
+// exportCondition converts a condition to its serializable form.
+// Conditions of types unknown to this package are exported as references to a
+// registered condition named after their String() representation, or rejected
+// when strict is set; wrap custom logic in a FuncCondition registered with
+// RegisterCondition to export it faithfully.
+func exportCondition(cond Condition, strict bool) (ConditionExport, error) {
+	switch c := cond.(type) {
+	case *TimeCondition:
+		export := ConditionExport{Type: conditionTypeTime}
+		for _, hours := range c.AllowedHours {
+			export.Hours = append(export.Hours, HourRangeExport{Start: hours.Start, End: hours.End})
+		}
+		for _, day := range c.AllowedDays {
+			export.Days = append(export.Days, strings.ToLower(day.String()))
+		}
+		if c.Timezone != nil {
+			export.Timezone = c.Timezone.String()
+		}
+		return export, nil
+	case *IPCondition:
+		export := ConditionExport{Type: conditionTypeIP}
+		for _, network := range c.AllowedNetworks {
+			export.Allow = append(export.Allow, network.String())
+		}
+		for _, network := range c.DeniedNetworks {
+			export.Deny = append(export.Deny, network.String())
+		}
+		return export, nil
+	case *MetadataCondition:
+		return ConditionExport{
+			Type:          conditionTypeMetadata,
+			Key:           c.Key,
+			Values:        c.Values,
+			CaseSensitive: c.CaseSensitive,
+		}, nil
+	case *FuncCondition:
+		return ConditionExport{Type: conditionTypeFunc, Name: c.Name}, nil
+	case *AndCondition:
+		return exportComposite(conditionTypeAnd, c.Conditions, strict)
+	case *OrCondition:
+		return exportComposite(conditionTypeOr, c.Conditions, strict)
+	case *NotCondition:
+		return exportComposite(conditionTypeNot, []Condition{c.Condition}, strict)
+	default:
+		if !strict {
+			return ConditionExport{Type: conditionTypeFunc, Name: cond.String()}, nil
+		}
+		return ConditionExport{}, fmt.Errorf("%w: %s of type %T", ErrUnsupportedCondition, cond, cond)
+	}
+}
+
+// exportComposite exports a condition made of sub-conditions
+func exportComposite(typ string, conds []Condition, strict bool) (ConditionExport, error) {
+	exports, err := exportConditions(conds, strict)
+	if err != nil {
+		return ConditionExport{}, err
+	}
+	return ConditionExport{Type: typ, Conditions: exports}, nil
+}
+
+// importConditions converts serialized conditions back into conditions
+func importConditions(exports []ConditionExport) ([]Condition, error) {
+	if len(exports) == 0 {
+		return nil, nil
+	}
+	result := make([]Condition, len(exports))
+	for i, export := range exports {
+		cond, err := importCondition(export)
+		if err != nil {
+			return nil, fmt.Errorf("condition %d: %w", i, err)
+		}
+		result[i] = cond
+	}
+	return result, nil
+}
+
+// importCondition converts a serialized condition back into a condition
+func importCondition(export ConditionExport) (Condition, error) {
+	switch export.Type {
+	case conditionTypeTime:
+		cond := &TimeCondition{}
+		for _, hours := range export.Hours {
+			if hours.Start < 0 || hours.Start > 23 || hours.End < 0 || hours.End > 23 {
+				return nil, fmt.Errorf("invalid hour range: %d-%d", hours.Start, hours.End)
+			}
+			cond.AllowedHours = append(cond.AllowedHours, HourRange{Start: hours.Start, End: hours.End})
+		}
+		for _, name := range export.Days {
+			day, err := stringToWeekday(name)
+			if err != nil {
+				return nil, err
+			}
+			cond.AllowedDays = append(cond.AllowedDays, day)
+		}
+		if export.Timezone != "" {
+			loc, err := time.LoadLocation(export.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timezone: %w", err)
+			}
+			cond.Timezone = loc
+		}
+		return cond, nil
+	case conditionTypeIP:
+		return NewIPCondition(export.Allow, export.Deny)
+	case conditionTypeMetadata:
+		if export.Key == "" {
+			return nil, fmt.Errorf("metadata condition requires a key")
+		}
+		return &MetadataCondition{
+			Key:           export.Key,
+			Values:        export.Values,
+			CaseSensitive: export.CaseSensitive,
+		}, nil
+	case conditionTypeFunc:
+		fn, ok := LookupCondition(export.Name)
+		if !ok {
+			return nil, fmt.Errorf("condition %q is not registered", export.Name)
+		}
+		return NewFuncCondition(export.Name, fn), nil
+	case conditionTypeAnd, conditionTypeOr:
+		conds, err := importConditions(export.Conditions)
+		if err != nil {
+			return nil, err
+		}
+		if export.Type == conditionTypeAnd {
+			return &AndCondition{Conditions: conds}, nil
+		}
+		return &OrCondition{Conditions: conds}, nil
+	case conditionTypeNot:
+		if len(export.Conditions) != 1 {
+			return nil, fmt.Errorf("not condition requires exactly one condition, got %d", len(export.Conditions))
+		}
+		cond, err := importCondition(export.Conditions[0])
+		if err != nil {
+			return nil, err
+		}
+		return &NotCondition{Condition: cond}, nil
+	default:
+		return nil, fmt.Errorf("unknown condition type: %q", export.Type)
+	}
+}
+
+func stringToWeekday(s string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(s, day.String()) {
+			return day, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("invalid day: %s", s)
+}
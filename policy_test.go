@@ -2,8 +2,11 @@ package permfs
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestPolicyExportImport(t *testing.T) {
@@ -245,3 +248,190 @@ func TestInvalidPolicyImport(t *testing.T) {
 		})
 	}
 }
+
+func TestPolicyConditionsRoundTrip(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone database unavailable: %v", err)
+	}
+	ipCond, _ := NewIPCondition([]string{"10.0.0.0/8"}, []string{"10.1.0.0/16"})
+	onCall := RegisterCondition("on-call", func(ctx *EvaluationContext) bool {
+		return ctx.Metadata["on_call"] == true
+	})
+	defer UnregisterCondition("on-call")
+
+	acl := ACL{
+		Default: Deny,
+		Entries: []ACLEntry{
+			{
+				Subject:     User("alice"),
+				PathPattern: "/ops/**",
+				Permissions: Read,
+				Effect:      Allow,
+				Priority:    100,
+				Conditions: []Condition{
+					&TimeCondition{
+						AllowedHours: []HourRange{{Start: 8, End: 18}},
+						AllowedDays:  []time.Weekday{time.Monday, time.Friday},
+						Timezone:     berlin,
+					},
+					&OrCondition{Conditions: []Condition{
+						ipCond,
+						&AndCondition{Conditions: []Condition{
+							onCall,
+							&NotCondition{Condition: &MetadataCondition{Key: "device", Values: []string{"kiosk"}, CaseSensitive: true}},
+						}},
+					}},
+				},
+			},
+		},
+	}
+
+	for _, format := range []PolicyFormat{PolicyFormatJSON, PolicyFormatYAML} {
+		var buf bytes.Buffer
+		if err := SavePolicy(ExportPolicy(acl, ""), &buf, format); err != nil {
+			t.Fatalf("SavePolicy failed: %v", err)
+		}
+		policy, err := LoadPolicy(&buf, format)
+		if err != nil {
+			t.Fatalf("LoadPolicy failed: %v", err)
+		}
+		imported, err := ImportPolicy(policy)
+		if err != nil {
+			t.Fatalf("ImportPolicy failed: %v", err)
+		}
+
+		conds := imported.Entries[0].Conditions
+		if len(conds) != 2 {
+			t.Fatalf("expected 2 conditions, got %d", len(conds))
+		}
+		tc, ok := conds[0].(*TimeCondition)
+		if !ok || tc.Timezone.String() != "Europe/Berlin" || len(tc.AllowedDays) != 2 ||
+			tc.AllowedDays[1] != time.Friday || tc.AllowedHours[0] != (HourRange{Start: 8, End: 18}) {
+			t.Errorf("time condition not preserved: %+v", conds[0])
+		}
+
+		// Re-exporting yields the same serialized form
+		if got, want := fmt.Sprint(ExportPolicy(imported, "").Entries), fmt.Sprint(ExportPolicy(acl, "").Entries); got != want {
+			t.Errorf("round trip mismatch:\n got %s\nwant %s", got, want)
+		}
+
+		// The imported conditions evaluate like the originals
+		ctx := &EvaluationContext{Metadata: map[string]interface{}{
+			"source_ip": "192.168.1.1",
+			"on_call":   true,
+			"device":    "laptop",
+		}}
+		if !conds[1].Evaluate(ctx) {
+			t.Error("expected on-call branch to allow")
+		}
+		ctx.Metadata["device"] = "kiosk"
+		if conds[1].Evaluate(ctx) {
+			t.Error("expected kiosk device to be refused")
+		}
+		ctx.Metadata["source_ip"] = "10.2.3.4"
+		if !conds[1].Evaluate(ctx) {
+			t.Error("expected allowed network to be accepted")
+		}
+	}
+}
+
+func TestPolicyConditionImportErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cond ConditionExport
+	}{
+		{"unknown type", ConditionExport{Type: "weather"}},
+		{"unregistered func", ConditionExport{Type: "func", Name: "missing"}},
+		{"invalid cidr", ConditionExport{Type: "ip", Allow: []string{"10.0.0.0/99"}}},
+		{"invalid timezone", ConditionExport{Type: "time", Timezone: "Mars/Olympus"}},
+		{"invalid day", ConditionExport{Type: "time", Days: []string{"someday"}}},
+		{"invalid hours", ConditionExport{Type: "time", Hours: []HourRangeExport{{Start: 9, End: 24}}}},
+		{"metadata without key", ConditionExport{Type: "metadata"}},
+		{"not without condition", ConditionExport{Type: "not"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &PolicyFile{
+				Version: "1.0",
+				Default: "deny",
+				Entries: []PolicyEntryExport{
+					{
+						Subject:     SubjectExport{Type: "user", ID: "alice"},
+						PathPattern: "/data",
+						Permissions: []string{"read"},
+						Effect:      "allow",
+						Conditions:  []ConditionExport{tt.cond},
+					},
+				},
+			}
+			if _, err := ImportPolicy(policy); err == nil {
+				t.Error("expected import to fail")
+			}
+		})
+	}
+}
+
+func TestPolicyConditionExportErrors(t *testing.T) {
+	acl := ACL{
+		Default: Deny,
+		Entries: []ACLEntry{
+			{Subject: User("alice"), PathPattern: "/data/**", Permissions: Read, Effect: Allow},
+			{Subject: User("alice"), PathPattern: "/data/**", Permissions: Write, Effect: Allow,
+				Conditions: []Condition{&NotCondition{Condition: &sessionCondition{}}}},
+		},
+	}
+
+	if _, err := ExportPolicyStrict(acl, ""); !errors.Is(err, ErrUnsupportedCondition) {
+		t.Errorf("expected ErrUnsupportedCondition, got %v", err)
+	}
+	if _, err := FormatPolicyText(acl); !errors.Is(err, ErrUnsupportedCondition) {
+		t.Errorf("expected FormatPolicyText to fail with ErrUnsupportedCondition, got %v", err)
+	}
+
+	// ExportPolicy keeps exporting unknown conditions as references by name
+	policy := ExportPolicy(acl, "")
+	inner := policy.Entries[1].Conditions[0].Conditions[0]
+	if inner.Type != conditionTypeFunc || inner.Name != (&sessionCondition{}).String() {
+		t.Errorf("expected a func reference named after the condition, got %+v", inner)
+	}
+}
+
+func TestPolicyRuleMetadataRoundTrip(t *testing.T) {
+	acl := ACL{
+		Default: Deny,
+		Entries: []ACLEntry{
+			{
+				ID:          "eng-projects",
+				Name:        "Engineering projects",
+				Description: "Owned by platform team, see OPS-142",
+				Tags:        []string{"eng", "projects"},
+				Subject:     Group("eng"),
+				PathPattern: "/projects/**",
+				Permissions: ReadWrite,
+				Effect:      Allow,
+			},
+		},
+	}
+
+	for _, format := range []PolicyFormat{PolicyFormatJSON, PolicyFormatYAML, PolicyFormatText} {
+		var buf bytes.Buffer
+		if err := SavePolicy(ExportPolicy(acl, ""), &buf, format); err != nil {
+			t.Fatalf("format %d: SavePolicy failed: %v", format, err)
+		}
+		policy, err := LoadPolicy(&buf, format)
+		if err != nil {
+			t.Fatalf("format %d: LoadPolicy failed: %v", format, err)
+		}
+		imported, err := ImportPolicy(policy)
+		if err != nil {
+			t.Fatalf("format %d: ImportPolicy failed: %v", format, err)
+		}
+
+		got, want := imported.Entries[0], acl.Entries[0]
+		if got.ID != want.ID || got.Name != want.Name || got.Description != want.Description ||
+			strings.Join(got.Tags, ",") != strings.Join(want.Tags, ",") {
+			t.Errorf("format %d: metadata not preserved: %+v", format, got)
+		}
+	}
+}
@@ -0,0 +1,854 @@
+package permfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The text policy format (PolicyFormatText) describes one rule per line:
+//
+//	# comments start with '#'
+//	description "Engineering file server"
+//	default deny
+//	combining deny-overrides
+//
+//	allow group:eng read,write /projects/** priority 10 when ip in 10.0.0.0/8
+//	deny everyone all /hr/** priority 100 conceal id hr-lockdown tags hr,legal
+//	allow role:oncall read /ops/** when time days monday,friday hours 8-18 tz Europe/Berlin
+//	allow user:contractor read,write /projects/apollo/** not-after 2026-03-31T00:00:00Z
+//	allow user:alice read /data/** when (func on-call or meta device in laptop,desktop) and not ip in 192.168.0.0/16
+//
+// A rule is: effect subject permissions pattern [options] [when condition], where the
+// options are priority N, conceal, id ID, name NAME, description TEXT, tags TAG,...,
+// not-before TIME and not-after TIME (RFC 3339, e.g. 2026-01-31T18:00:00Z).
+// Subjects are user:ID, group:ID, role:ID or everyone. Permissions are a comma
+// separated list of read, write, execute, delete, metadata and admin, or all.
+// Conditions are combined with and, or, not and parentheses from these atoms:
+//
+//	ip [in CIDR,...] [except CIDR,...]
+//	time [days DAY,...] [hours H-H,...] [tz ZONE]
+//	meta KEY in VALUE,... [case-sensitive]
+//	func NAME
+//
+// An ip or time atom needs at least one clause; one without restrictions is
+// written as ip in 0.0.0.0/0,::/0 or time hours 0-23.
+//
+// Policies can be composed from several files (see LoadPolicyTree) with:
+//
+//	include teams/eng.policy
+//	define layer org offset 10000
+//	define layer team offset 1000 ceiling 999
+//	layer team
+//
+// Any token containing spaces or one of , ( ) " # can be written as a Go-style
+// double-quoted string.
+
+// PolicySyntaxError reports a malformed line in a text policy
+type PolicySyntaxError struct {
+	// Line is the 1-based line number
+	Line int
+	// Column is the 1-based byte column
+	Column int
+	// Message describes the problem
+	Message string
+}
+
+// Error implements the error interface
+func (e *PolicySyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// ParsePolicyText parses a text policy into an ACL
+func ParsePolicyText(text string) (ACL, error) {
+	policy, err := parsePolicyText(text)
+	if err != nil {
+		return ACL{}, err
+	}
+	return ImportPolicy(policy)
+}
+
+// FormatPolicyText formats an ACL as canonical text policy
+func FormatPolicyText(acl ACL) (string, error) {
+	policy, err := ExportPolicyStrict(acl, "")
+	if err != nil {
+		return "", err
+	}
+	return formatPolicyText(policy)
+}
+
+// textToken is a single token of a text policy line
+type textToken struct {
+	text   string
+	col    int
+	quoted bool
+}
+
+// textLine holds the tokens of one line and the parser position within it
+type textLine struct {
+	num  int
+	end  int
+	toks []textToken
+	pos  int
+}
+
+func (l *textLine) errorf(tok *textToken, format string, args ...interface{}) error {
+	col := l.end
+	if tok != nil {
+		col = tok.col
+	}
+	return &PolicySyntaxError{Line: l.num, Column: col, Message: fmt.Sprintf(format, args...)}
+}
+
+func (l *textLine) peek() *textToken {
+	if l.pos >= len(l.toks) {
+		return nil
+	}
+	return &l.toks[l.pos]
+}
+
+func (l *textLine) next() *textToken {
+	tok := l.peek()
+	if tok != nil {
+		l.pos++
+	}
+	return tok
+}
+
+// is reports whether the next token is the unquoted keyword kw
+func (l *textLine) is(kw string) bool {
+	tok := l.peek()
+	return tok != nil && !tok.quoted && tok.text == kw
+}
+
+// accept consumes the next token if it is the unquoted keyword kw
+func (l *textLine) accept(kw string) bool {
+	if l.is(kw) {
+		l.pos++
+		return true
+	}
+	return false
+}
+
+// value consumes the next token, which must not be punctuation
+func (l *textLine) value(what string) (*textToken, error) {
+	tok := l.next()
+	if tok == nil {
+		return nil, l.errorf(nil, "expected %s", what)
+	}
+	if !tok.quoted && isTextPunct(tok.text) {
+		return nil, l.errorf(tok, "expected %s, got %q", what, tok.text)
+	}
+	return tok, nil
+}
+
+// list consumes a comma separated list of values
+func (l *textLine) list(what string) ([]*textToken, error) {
+	var items []*textToken
+	for {
+		tok, err := l.value(what)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, tok)
+		if !l.accept(",") {
+			return items, nil
+		}
+	}
+}
+
+func isTextPunct(s string) bool {
+	return s == "," || s == "(" || s == ")"
+}
+
+// tokenizeTextLine splits a line into tokens, dropping comments
+func tokenizeTextLine(num int, line string) (*textLine, error) {
+	l := &textLine{num: num, end: len(line) + 1}
+	i := 0
+	for i < len(line) {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			return l, nil
+		case c == ',' || c == '(' || c == ')':
+			l.toks = append(l.toks, textToken{text: string(c), col: i + 1})
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(line) && line[j] != '"' {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(line) {
+				return nil, &PolicySyntaxError{Line: num, Column: i + 1, Message: "unterminated quoted string"}
+			}
+			text, err := strconv.Unquote(line[i : j+1])
+			if err != nil {
+				return nil, &PolicySyntaxError{Line: num, Column: i + 1, Message: "invalid quoted string"}
+			}
+			l.toks = append(l.toks, textToken{text: text, col: i + 1, quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(line) && !strings.ContainsRune(" \t\r,()\"", rune(line[j])) {
+				j++
+			}
+			l.toks = append(l.toks, textToken{text: line[i:j], col: i + 1})
+			i = j
+		}
+	}
+	return l, nil
+}
+
+// parsePolicyText parses a text policy into its serializable form
+func parsePolicyText(text string) (*PolicyFile, error) {
+	policy, _, err := parsePolicyTextLines(text)
+	return policy, err
+}
+
+// parsePolicyTextLines parses a text policy and also returns the line of each entry
+func parsePolicyTextLines(text string) (*PolicyFile, []int, error) {
+	policy := &PolicyFile{Version: "1.0", Default: "deny"}
+	var lines []int
+	seenDefault := false
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for num := 1; scanner.Scan(); num++ {
+		l, err := tokenizeTextLine(num, scanner.Text())
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(l.toks) == 0 {
+			continue
+		}
+
+		switch {
+		case l.accept("default"):
+			if seenDefault {
+				return nil, nil, l.errorf(&l.toks[0], "duplicate default")
+			}
+			seenDefault = true
+			tok, err := l.value("allow or deny")
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, err := stringToEffect(tok.text); err != nil {
+				return nil, nil, l.errorf(tok, "expected allow or deny, got %q", tok.text)
+			}
+			policy.Default = tok.text
+		case l.accept("combining"):
+			tok, err := l.value("combining algorithm")
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, err := ParseCombiningAlgorithm(tok.text); err != nil {
+				return nil, nil, l.errorf(tok, "unknown combining algorithm %q", tok.text)
+			}
+			policy.Combining = tok.text
+		case l.accept("description"):
+			tok, err := l.value("description")
+			if err != nil {
+				return nil, nil, err
+			}
+			policy.Description = tok.text
+		case l.accept("version"):
+			tok, err := l.value("version")
+			if err != nil {
+				return nil, nil, err
+			}
+			policy.Version = tok.text
+		case l.is("allow") || l.is("deny"):
+			entry, err := l.parseRule()
+			if err != nil {
+				return nil, nil, err
+			}
+			policy.Entries = append(policy.Entries, entry)
+			lines = append(lines, num)
+		case l.accept("include"):
+			tok, err := l.value("file name")
+			if err != nil {
+				return nil, nil, err
+			}
+			policy.Include = append(policy.Include, tok.text)
+		case l.accept("define"):
+			layer, err := l.parseLayerDefinition()
+			if err != nil {
+				return nil, nil, err
+			}
+			policy.Layers = append(policy.Layers, layer)
+		case l.accept("layer"):
+			tok, err := l.value("layer name")
+			if err != nil {
+				return nil, nil, err
+			}
+			policy.Layer = tok.text
+		default:
+			return nil, nil, l.errorf(l.peek(), "expected a rule, default, combining, description, version, include, layer or define, got %q", l.peek().text)
+		}
+
+		if tok := l.peek(); tok != nil {
+			return nil, nil, l.errorf(tok, "unexpected %q", tok.text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return policy, lines, nil
+}
+
+// parseLayerDefinition parses: "layer" NAME "offset" N ["ceiling" N]
+func (l *textLine) parseLayerDefinition() (PolicyLayer, error) {
+	var layer PolicyLayer
+	if !l.accept("layer") {
+		return layer, l.errorf(l.peek(), "expected layer")
+	}
+	name, err := l.value("layer name")
+	if err != nil {
+		return layer, err
+	}
+	layer.Name = name.text
+
+	number := func(what string) (int, error) {
+		tok, err := l.value(what)
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return 0, l.errorf(tok, "invalid %s %q", what, tok.text)
+		}
+		return n, nil
+	}
+
+	if !l.accept("offset") {
+		return layer, l.errorf(l.peek(), "expected offset")
+	}
+	if layer.Offset, err = number("offset"); err != nil {
+		return layer, err
+	}
+	if l.accept("ceiling") {
+		if layer.Ceiling, err = number("ceiling"); err != nil {
+			return layer, err
+		}
+	}
+	return layer, nil
+}
+
+// parseRule parses: effect subject permissions pattern [options] [when condition]
+func (l *textLine) parseRule() (PolicyEntryExport, error) {
+	var entry PolicyEntryExport
+	entry.Effect = l.next().text
+
+	tok, err := l.value("subject")
+	if err != nil {
+		return entry, err
+	}
+	if tok.text == "everyone" {
+		entry.Subject = SubjectExport{Type: "everyone", ID: Everyone().ID}
+	} else {
+		typ, id, ok := strings.Cut(tok.text, ":")
+		if _, err := stringToSubjectType(typ); !ok || err != nil || typ == "everyone" || id == "" {
+			return entry, l.errorf(tok, "expected subject user:ID, group:ID, role:ID or everyone, got %q", tok.text)
+		}
+		entry.Subject = SubjectExport{Type: typ, ID: id}
+	}
+
+	perms, err := l.list("permission")
+	if err != nil {
+		return entry, err
+	}
+	for _, perm := range perms {
+		if _, err := stringsToOperations([]string{perm.text}); err != nil {
+			return entry, l.errorf(perm, "unknown permission %q", perm.text)
+		}
+		entry.Permissions = append(entry.Permissions, perm.text)
+	}
+
+	tok, err = l.value("path pattern")
+	if err != nil {
+		return entry, err
+	}
+	entry.PathPattern = tok.text
+
+	for l.peek() != nil {
+		switch {
+		case l.accept("priority"):
+			tok, err := l.value("priority")
+			if err != nil {
+				return entry, err
+			}
+			priority, err := strconv.Atoi(tok.text)
+			if err != nil {
+				return entry, l.errorf(tok, "invalid priority %q", tok.text)
+			}
+			entry.Priority = priority
+		case l.accept("conceal"):
+			entry.Conceal = true
+		case l.accept("id"):
+			tok, err := l.value("rule ID")
+			if err != nil {
+				return entry, err
+			}
+			entry.ID = tok.text
+		case l.accept("name"):
+			tok, err := l.value("rule name")
+			if err != nil {
+				return entry, err
+			}
+			entry.Name = tok.text
+		case l.accept("description"):
+			tok, err := l.value("rule description")
+			if err != nil {
+				return entry, err
+			}
+			entry.Description = tok.text
+		case l.accept("tags"):
+			tags, err := l.list("tag")
+			if err != nil {
+				return entry, err
+			}
+			for _, tag := range tags {
+				entry.Tags = append(entry.Tags, tag.text)
+			}
+		case l.is("not-before") || l.is("not-after"):
+			keyword := l.next().text
+			tok, err := l.value("RFC 3339 time")
+			if err != nil {
+				return entry, err
+			}
+			t, err := time.Parse(time.RFC3339, tok.text)
+			if err != nil {
+				return entry, l.errorf(tok, "invalid time %q, expected RFC 3339", tok.text)
+			}
+			if keyword == "not-before" {
+				entry.NotBefore = &t
+			} else {
+				entry.NotAfter = &t
+			}
+		case l.accept("when"):
+			cond, err := l.parseOr()
+			if err != nil {
+				return entry, err
+			}
+			// A top-level conjunction becomes the entry's condition list
+			if cond.Type == conditionTypeAnd {
+				entry.Conditions = cond.Conditions
+			} else {
+				entry.Conditions = []ConditionExport{cond}
+			}
+			return entry, nil
+		default:
+			return entry, l.errorf(l.peek(), "expected priority, conceal, id, name, description, tags, not-before, not-after or when, got %q", l.peek().text)
+		}
+	}
+	return entry, nil
+}
+
+// parseOr parses: and-expression ("or" and-expression)*
+func (l *textLine) parseOr() (ConditionExport, error) {
+	return l.parseBinary(conditionTypeOr, l.parseAnd)
+}
+
+// parseAnd parses: unary ("and" unary)*
+func (l *textLine) parseAnd() (ConditionExport, error) {
+	return l.parseBinary(conditionTypeAnd, l.parseUnary)
+}
+
+func (l *textLine) parseBinary(op string, operand func() (ConditionExport, error)) (ConditionExport, error) {
+	var conds []ConditionExport
+	// Flatten nested use of the same operator so the canonical form has no redundant nesting
+	add := func(cond ConditionExport) {
+		if cond.Type == op {
+			conds = append(conds, cond.Conditions...)
+		} else {
+			conds = append(conds, cond)
+		}
+	}
+
+	cond, err := operand()
+	if err != nil {
+		return cond, err
+	}
+	add(cond)
+	for l.accept(op) {
+		cond, err := operand()
+		if err != nil {
+			return cond, err
+		}
+		add(cond)
+	}
+
+	if len(conds) == 1 {
+		return conds[0], nil
+	}
+	return ConditionExport{Type: op, Conditions: conds}, nil
+}
+
+// parseUnary parses: "not" unary | "(" or-expression ")" | atom
+func (l *textLine) parseUnary() (ConditionExport, error) {
+	if l.accept("not") {
+		cond, err := l.parseUnary()
+		if err != nil {
+			return cond, err
+		}
+		return ConditionExport{Type: conditionTypeNot, Conditions: []ConditionExport{cond}}, nil
+	}
+	if l.accept("(") {
+		cond, err := l.parseOr()
+		if err != nil {
+			return cond, err
+		}
+		if !l.accept(")") {
+			return cond, l.errorf(l.peek(), "expected )")
+		}
+		return cond, nil
+	}
+	return l.parseAtom()
+}
+
+// parseAtom parses a single ip, time, meta or func condition
+func (l *textLine) parseAtom() (ConditionExport, error) {
+	tok := l.next()
+	if tok == nil {
+		return ConditionExport{}, l.errorf(nil, "expected condition")
+	}
+	if tok.quoted {
+		return ConditionExport{}, l.errorf(tok, "expected condition, got %q", tok.text)
+	}
+
+	switch tok.text {
+	case "ip":
+		cond := ConditionExport{Type: conditionTypeIP}
+		if l.accept("in") {
+			cidrs, err := l.cidrList()
+			if err != nil {
+				return cond, err
+			}
+			cond.Allow = cidrs
+		}
+		if l.accept("except") {
+			cidrs, err := l.cidrList()
+			if err != nil {
+				return cond, err
+			}
+			cond.Deny = cidrs
+		}
+		if cond.Allow == nil && cond.Deny == nil {
+			return cond, l.errorf(l.peek(), "expected in or except")
+		}
+		return cond, nil
+
+	case "time":
+		cond := ConditionExport{Type: conditionTypeTime}
+		for {
+			switch {
+			case l.accept("days"):
+				days, err := l.list("day")
+				if err != nil {
+					return cond, err
+				}
+				for _, day := range days {
+					if _, err := stringToWeekday(day.text); err != nil {
+						return cond, l.errorf(day, "unknown day %q", day.text)
+					}
+					cond.Days = append(cond.Days, strings.ToLower(day.text))
+				}
+			case l.accept("hours"):
+				ranges, err := l.list("hour range")
+				if err != nil {
+					return cond, err
+				}
+				for _, r := range ranges {
+					hours, ok := parseHourRange(r.text)
+					if !ok {
+						return cond, l.errorf(r, "invalid hour range %q", r.text)
+					}
+					cond.Hours = append(cond.Hours, hours)
+				}
+			case l.accept("tz"):
+				zone, err := l.value("timezone")
+				if err != nil {
+					return cond, err
+				}
+				if _, err := time.LoadLocation(zone.text); err != nil {
+					return cond, l.errorf(zone, "unknown timezone %q", zone.text)
+				}
+				cond.Timezone = zone.text
+			default:
+				if cond.Days == nil && cond.Hours == nil && cond.Timezone == "" {
+					return cond, l.errorf(l.peek(), "expected days, hours or tz")
+				}
+				return cond, nil
+			}
+		}
+
+	case "meta":
+		key, err := l.value("metadata key")
+		if err != nil {
+			return ConditionExport{}, err
+		}
+		if !l.accept("in") {
+			return ConditionExport{}, l.errorf(l.peek(), "expected in")
+		}
+		values, err := l.list("value")
+		if err != nil {
+			return ConditionExport{}, err
+		}
+		cond := ConditionExport{Type: conditionTypeMetadata, Key: key.text}
+		for _, v := range values {
+			cond.Values = append(cond.Values, v.text)
+		}
+		cond.CaseSensitive = l.accept("case-sensitive")
+		return cond, nil
+
+	case "func":
+		name, err := l.value("condition name")
+		if err != nil {
+			return ConditionExport{}, err
+		}
+		return ConditionExport{Type: conditionTypeFunc, Name: name.text}, nil
+
+	default:
+		return ConditionExport{}, l.errorf(tok, "unknown condition %q", tok.text)
+	}
+}
+
+func (l *textLine) cidrList() ([]string, error) {
+	toks, err := l.list("CIDR")
+	if err != nil {
+		return nil, err
+	}
+	cidrs := make([]string, len(toks))
+	for i, tok := range toks {
+		if _, _, err := net.ParseCIDR(tok.text); err != nil {
+			return nil, l.errorf(tok, "invalid CIDR %q", tok.text)
+		}
+		cidrs[i] = tok.text
+	}
+	return cidrs, nil
+}
+
+// parseHourRange parses "H" or "H-H" with hours between 0 and 23
+func parseHourRange(s string) (HourRangeExport, bool) {
+	startStr, endStr, found := strings.Cut(s, "-")
+	if !found {
+		endStr = startStr
+	}
+	start, err1 := strconv.Atoi(startStr)
+	end, err2 := strconv.Atoi(endStr)
+	if err1 != nil || err2 != nil || start < 0 || start > 23 || end < 0 || end > 23 {
+		return HourRangeExport{}, false
+	}
+	return HourRangeExport{Start: start, End: end}, true
+}
+
+// formatPolicyText renders a policy in canonical text form.
+// It fails if an entry cannot be written so that it reads back the same.
+func formatPolicyText(policy *PolicyFile) (string, error) {
+	var b strings.Builder
+	if policy.Description != "" {
+		fmt.Fprintf(&b, "description %s\n", strconv.Quote(policy.Description))
+	}
+	def := policy.Default
+	if def == "" {
+		def = "deny"
+	}
+	fmt.Fprintf(&b, "default %s\n", def)
+	if policy.Combining != "" {
+		fmt.Fprintf(&b, "combining %s\n", policy.Combining)
+	}
+
+	if len(policy.Include) > 0 || len(policy.Layers) > 0 || policy.Layer != "" {
+		b.WriteString("\n")
+	}
+	for _, include := range policy.Include {
+		fmt.Fprintf(&b, "include %s\n", quoteTextToken(include))
+	}
+	for _, layer := range policy.Layers {
+		fmt.Fprintf(&b, "define layer %s offset %d", quoteTextToken(layer.Name), layer.Offset)
+		if layer.Ceiling != 0 {
+			fmt.Fprintf(&b, " ceiling %d", layer.Ceiling)
+		}
+		b.WriteString("\n")
+	}
+	if policy.Layer != "" {
+		fmt.Fprintf(&b, "layer %s\n", quoteTextToken(policy.Layer))
+	}
+
+	if len(policy.Entries) > 0 {
+		b.WriteString("\n")
+	}
+
+	for i, entry := range policy.Entries {
+		if _, err := stringToSubjectType(entry.Subject.Type); err != nil {
+			return "", fmt.Errorf("%w: entry %d: %v", ErrInvalidConfig, i, err)
+		}
+		subject := "everyone"
+		if entry.Subject.Type != "everyone" {
+			subject = quoteTextToken(entry.Subject.Type + ":" + entry.Subject.ID)
+		}
+		fmt.Fprintf(&b, "%s %s %s %s", entry.Effect, subject,
+			formatTextPermissions(entry.Permissions), quoteTextToken(entry.PathPattern))
+		if entry.Priority != 0 {
+			fmt.Fprintf(&b, " priority %d", entry.Priority)
+		}
+		if entry.Conceal {
+			b.WriteString(" conceal")
+		}
+		if entry.ID != "" {
+			fmt.Fprintf(&b, " id %s", quoteTextToken(entry.ID))
+		}
+		if entry.Name != "" {
+			fmt.Fprintf(&b, " name %s", quoteTextToken(entry.Name))
+		}
+		if entry.Description != "" {
+			fmt.Fprintf(&b, " description %s", quoteTextToken(entry.Description))
+		}
+		if len(entry.Tags) > 0 {
+			fmt.Fprintf(&b, " tags %s", joinTextTokens(entry.Tags))
+		}
+		if entry.NotBefore != nil {
+			fmt.Fprintf(&b, " not-before %s", entry.NotBefore.Format(time.RFC3339Nano))
+		}
+		if entry.NotAfter != nil {
+			fmt.Fprintf(&b, " not-after %s", entry.NotAfter.Format(time.RFC3339Nano))
+		}
+		if len(entry.Conditions) > 0 {
+			conditions, err := formatTextConditions(conditionTypeAnd, entry.Conditions)
+			if err != nil {
+				return "", fmt.Errorf("entry %d: %w", i, err)
+			}
+			b.WriteString(" when ")
+			b.WriteString(conditions)
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// formatTextPermissions writes permissions in canonical order, or "all"
+func formatTextPermissions(perms []string) string {
+	ops, err := stringsToOperations(perms)
+	if err != nil {
+		return strings.Join(perms, ",")
+	}
+	if ops == OperationAll {
+		return "all"
+	}
+	return strings.Join(operationsToStrings(ops), ",")
+}
+
+// formatTextConditions joins conditions with op ("and" or "or")
+func formatTextConditions(op string, conds []ConditionExport) (string, error) {
+	parts := make([]string, len(conds))
+	for i, cond := range conds {
+		text, err := formatTextCondition(cond)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = text
+		// "and" binds tighter than "or", so only an "or" inside an "and" needs parentheses
+		if op == conditionTypeAnd && len(conds) > 1 && cond.Type == conditionTypeOr && len(cond.Conditions) > 1 {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " "+op+" "), nil
+}
+
+func formatTextCondition(cond ConditionExport) (string, error) {
+	switch cond.Type {
+	case conditionTypeAnd, conditionTypeOr:
+		return formatTextConditions(cond.Type, cond.Conditions)
+	case conditionTypeNot:
+		if len(cond.Conditions) != 1 {
+			return "not ()", nil
+		}
+		inner := cond.Conditions[0]
+		text, err := formatTextCondition(inner)
+		if err != nil {
+			return "", err
+		}
+		if (inner.Type == conditionTypeAnd || inner.Type == conditionTypeOr) && len(inner.Conditions) > 1 {
+			text = "(" + text + ")"
+		}
+		return "not " + text, nil
+	case conditionTypeIP:
+		text := "ip"
+		if len(cond.Allow) > 0 {
+			text += " in " + joinTextTokens(cond.Allow)
+		} else if len(cond.Deny) == 0 {
+			// No networks admits every address
+			text += " in 0.0.0.0/0,::/0"
+		}
+		if len(cond.Deny) > 0 {
+			text += " except " + joinTextTokens(cond.Deny)
+		}
+		return text, nil
+	case conditionTypeTime:
+		text := "time"
+		if len(cond.Days) > 0 {
+			text += " days " + joinTextTokens(cond.Days)
+		}
+		if len(cond.Hours) > 0 {
+			hours := make([]string, len(cond.Hours))
+			for i, h := range cond.Hours {
+				hours[i] = fmt.Sprintf("%d-%d", h.Start, h.End)
+			}
+			text += " hours " + strings.Join(hours, ",")
+		}
+		if cond.Timezone != "" {
+			text += " tz " + quoteTextToken(cond.Timezone)
+		}
+		if text == "time" {
+			// No restrictions admits every time
+			text += " hours 0-23"
+		}
+		return text, nil
+	case conditionTypeMetadata:
+		if len(cond.Values) == 0 {
+			// "meta KEY in" with nothing after it does not parse
+			return "", fmt.Errorf("%w: meta %s has no values", ErrUnsupportedCondition, quoteTextToken(cond.Key))
+		}
+		text := "meta " + quoteTextToken(cond.Key) + " in " + joinTextTokens(cond.Values)
+		if cond.CaseSensitive {
+			text += " case-sensitive"
+		}
+		return text, nil
+	default:
+		return "func " + quoteTextToken(cond.Name), nil
+	}
+}
+
+func joinTextTokens(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quoteTextToken(v)
+	}
+	return strings.Join(quoted, ",")
+}
+
+// quoteTextToken quotes s if it would not read back as a single token
+func quoteTextToken(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n,()\"#\\") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// readPolicyText parses a text policy from a reader
+func readPolicyText(r io.Reader) (*PolicyFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parsePolicyText(string(data))
+}
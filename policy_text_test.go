@@ -0,0 +1,229 @@
+package permfs
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const samplePolicyText = `# Engineering file server
+description "Engineering file server"
+default deny
+
+allow group:eng read,write /projects/** priority 10 when ip in 10.0.0.0/8
+deny everyone all /hr/** priority 100 conceal tags hr,legal id hr-lockdown name "HR lockdown"   # hidden from everyone
+allow role:oncall read /ops/** when time days monday,friday hours 8-18 tz UTC
+allow user:alice read /data/** when (func on-call or meta device in laptop,"work station") and not ip in 192.168.0.0/16
+allow "user:john doe" metadata,read "/shared/with space/*"
+`
+
+func TestParsePolicyText(t *testing.T) {
+	RegisterCondition("on-call", func(ctx *EvaluationContext) bool { return true })
+	defer UnregisterCondition("on-call")
+
+	acl, err := ParsePolicyText(samplePolicyText)
+	if err != nil {
+		t.Fatalf("ParsePolicyText failed: %v", err)
+	}
+	if acl.Default != Deny || len(acl.Entries) != 5 {
+		t.Fatalf("unexpected ACL: %+v", acl)
+	}
+
+	eng := acl.Entries[0]
+	if eng.Subject != Group("eng") || eng.Permissions != ReadWrite || eng.PathPattern != "/projects/**" ||
+		eng.Priority != 10 || eng.Effect != Allow || len(eng.Conditions) != 1 {
+		t.Errorf("unexpected first entry: %+v", eng)
+	}
+	if _, ok := eng.Conditions[0].(*IPCondition); !ok {
+		t.Errorf("expected IP condition, got %T", eng.Conditions[0])
+	}
+
+	hr := acl.Entries[1]
+	if hr.Subject != Everyone() || hr.Permissions != All || hr.Effect != Deny || !hr.Conceal {
+		t.Errorf("unexpected second entry: %+v", hr)
+	}
+	if hr.ID != "hr-lockdown" || hr.Name != "HR lockdown" || !hr.HasTags("hr", "legal") {
+		t.Errorf("rule metadata not parsed: %+v", hr)
+	}
+
+	// A top-level conjunction becomes the entry's condition list
+	alice := acl.Entries[3]
+	if len(alice.Conditions) != 2 {
+		t.Fatalf("expected 2 conditions, got %d", len(alice.Conditions))
+	}
+	if _, ok := alice.Conditions[0].(*OrCondition); !ok {
+		t.Errorf("expected OrCondition, got %T", alice.Conditions[0])
+	}
+	if _, ok := alice.Conditions[1].(*NotCondition); !ok {
+		t.Errorf("expected NotCondition, got %T", alice.Conditions[1])
+	}
+
+	john := acl.Entries[4]
+	if john.Subject != User("john doe") || john.PathPattern != "/shared/with space/*" {
+		t.Errorf("quoted tokens not parsed: %+v", john)
+	}
+}
+
+func TestFormatPolicyTextRoundTrip(t *testing.T) {
+	RegisterCondition("on-call", func(ctx *EvaluationContext) bool { return true })
+	defer UnregisterCondition("on-call")
+
+	acl, err := ParsePolicyText(samplePolicyText)
+	if err != nil {
+		t.Fatalf("ParsePolicyText failed: %v", err)
+	}
+	text, err := FormatPolicyText(acl)
+	if err != nil {
+		t.Fatalf("FormatPolicyText failed: %v", err)
+	}
+
+	want := `default deny
+
+allow group:eng read,write /projects/** priority 10 when ip in 10.0.0.0/8
+deny everyone all /hr/** priority 100 conceal id hr-lockdown name "HR lockdown" tags hr,legal
+allow role:oncall read /ops/** when time days monday,friday hours 8-18 tz UTC
+allow user:alice read /data/** when (func on-call or meta device in laptop,"work station") and not ip in 192.168.0.0/16
+allow "user:john doe" read,metadata "/shared/with space/*"
+`
+	if text != want {
+		t.Errorf("unexpected canonical text:\n%s\nwant:\n%s", text, want)
+	}
+
+	reparsed, err := ParsePolicyText(text)
+	if err != nil {
+		t.Fatalf("canonical text does not parse: %v", err)
+	}
+	if again, _ := FormatPolicyText(reparsed); again != text {
+		t.Errorf("formatting is not stable:\n%s\nvs\n%s", again, text)
+	}
+}
+
+func TestFormatPolicyTextEmptyConditions(t *testing.T) {
+	acl := ACL{
+		Default: Deny,
+		Entries: []ACLEntry{
+			{Subject: User("alice"), PathPattern: "/net/**", Permissions: Read, Effect: Allow,
+				Conditions: []Condition{&IPCondition{}}},
+			{Subject: User("alice"), PathPattern: "/clock/**", Permissions: Read, Effect: Allow,
+				Conditions: []Condition{&TimeCondition{}}},
+		},
+	}
+
+	text, err := FormatPolicyText(acl)
+	if err != nil {
+		t.Fatalf("FormatPolicyText failed: %v", err)
+	}
+	reparsed, err := ParsePolicyText(text)
+	if err != nil {
+		t.Fatalf("formatted text does not parse: %v\n%s", err, text)
+	}
+	if again, _ := FormatPolicyText(reparsed); again != text {
+		t.Errorf("formatting is not stable:\n%s\nvs\n%s", again, text)
+	}
+
+	// The reparsed conditions admit the same requests
+	original, parsed := NewEvaluator(acl), NewEvaluator(reparsed)
+	for _, path := range []string{"/net/a", "/clock/a"} {
+		for _, metadata := range []map[string]interface{}{nil, {"source_ip": "10.1.2.3"}, {"source_ip": "2001:db8::1"}} {
+			ctx := &EvaluationContext{
+				Identity:  &Identity{UserID: "alice"},
+				Path:      path,
+				Operation: OperationRead,
+				Metadata:  metadata,
+			}
+			want, _ := original.Evaluate(ctx)
+			if got, _ := parsed.Evaluate(ctx); got != want {
+				t.Errorf("%s with %v: expected %v after round trip, got %v", path, metadata, want, got)
+			}
+		}
+	}
+}
+
+func TestFormatPolicyTextUnwritable(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry ACLEntry
+		want  error
+	}{
+		{
+			name: "meta without values",
+			entry: ACLEntry{Subject: User("alice"), PathPattern: "/data/**", Permissions: Read, Effect: Allow,
+				Conditions: []Condition{&NotCondition{Condition: &MetadataCondition{Key: "device"}}}},
+			want: ErrUnsupportedCondition,
+		},
+		{
+			name:  "unknown subject type",
+			entry: ACLEntry{Subject: Subject{Type: SubjectType(99), ID: "alice"}, PathPattern: "/data/**", Permissions: Read, Effect: Allow},
+			want:  ErrInvalidConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acl := ACL{Default: Deny, Entries: []ACLEntry{tt.entry}}
+			if text, err := FormatPolicyText(acl); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v with text:\n%s", tt.want, err, text)
+			}
+
+			var buf bytes.Buffer
+			if err := SavePolicy(ExportPolicy(acl, ""), &buf, PolicyFormatText); !errors.Is(err, tt.want) {
+				t.Errorf("expected SavePolicy to fail with %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestPolicyFormatText(t *testing.T) {
+	policy, err := LoadPolicy(strings.NewReader(samplePolicyText), PolicyFormatText)
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: %v", err)
+	}
+	if policy.Description != "Engineering file server" || len(policy.Entries) != 5 {
+		t.Errorf("unexpected policy: %+v", policy)
+	}
+
+	var buf bytes.Buffer
+	if err := SavePolicy(policy, &buf, PolicyFormatText); err != nil {
+		t.Fatalf("SavePolicy failed: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), `description "Engineering file server"`+"\ndefault deny\n") {
+		t.Errorf("unexpected saved policy:\n%s", buf.String())
+	}
+}
+
+func TestParsePolicyTextErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		line   int
+		column int
+	}{
+		{"unknown directive", "permit user:a read /x", 1, 1},
+		{"bad subject", "allow alice read /x", 1, 7},
+		{"bad permission", "\nallow user:a read,fly /x", 2, 19},
+		{"missing pattern", "allow user:a read", 1, 18},
+		{"bad priority", "allow user:a read /x priority high", 1, 31},
+		{"trailing token", "allow user:a read /x extra", 1, 22},
+		{"missing id", "allow user:a read /x id", 1, 24},
+		{"empty tag", "allow user:a read /x tags a,", 1, 29},
+		{"bad time", "allow user:a read /x not-after tomorrow", 1, 32},
+		{"bad cidr", "allow user:a read /x when ip in 10.0.0.0/99", 1, 33},
+		{"bad hours", "allow user:a read /x when time hours 9-25", 1, 38},
+		{"unclosed paren", "allow user:a read /x when (func a", 1, 34},
+		{"unterminated quote", `allow "user:a read /x`, 1, 7},
+		{"duplicate default", "default deny\ndefault allow", 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePolicyText(tt.text)
+			var syntaxErr *PolicySyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("expected *PolicySyntaxError, got %v", err)
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column {
+				t.Errorf("expected line %d column %d, got %v", tt.line, tt.column, syntaxErr)
+			}
+		})
+	}
+}
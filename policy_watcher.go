@@ -0,0 +1,237 @@
+package permfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// PolicyWatcherConfig configures a PolicyWatcher
+type PolicyWatcherConfig struct {
+	// Path is the policy file to watch. It is loaded with LoadPolicyTree, and
+	// every file it includes is watched too.
+	Path string
+	// Format is the format of the policy file
+	Format PolicyFormat
+	// Interval is how often the file is polled (default: 5s)
+	Interval time.Duration
+	// OnReload is called after a new policy has been applied
+	OnReload func(acl ACL)
+	// OnError is called when a changed policy file is rejected
+	OnError func(err error)
+}
+
+// PolicyWatcher keeps a PermFS in sync with a policy file on disk.
+// The file and the files it includes are polled for changes to their
+// modification times and sizes, and their content hashes decide whether the
+// policy really changed. A changed policy is validated
+// with ValidateACL and swapped in atomically; when it cannot be loaded or is
+// invalid, the last good policy stays in effect. Every reload and rejection is
+// recorded in the audit log. A rejected file is not read again until it changes.
+type PolicyWatcher struct {
+	pfs    *PermFS
+	config PolicyWatcherConfig
+
+	// The files as last examined, whether the policy was applied or rejected
+	mu       sync.Mutex
+	snapshot policySnapshot
+	examined bool
+	lastErr  error
+
+	poller *poller
+}
+
+// NewPolicyWatcher creates a watcher that applies the policy file to pfs.
+// A relative Path is resolved against the current directory once, here.
+// Nothing is loaded until Start or Check is called.
+func NewPolicyWatcher(pfs *PermFS, config PolicyWatcherConfig) (*PolicyWatcher, error) {
+	if pfs == nil || config.Path == "" {
+		return nil, ErrInvalidConfig
+	}
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Second
+	}
+	// Loaded files are reported by absolute path, so the root is watched by one too
+	path, err := filepath.Abs(config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	config.Path = path
+
+	w := &PolicyWatcher{pfs: pfs, config: config}
+	w.poller = newPoller(config.Interval, func() { w.Check() })
+	return w, nil
+}
+
+// Start loads the policy file and then polls it in the background until Stop is called.
+// The error from the initial load is returned, but polling starts regardless so that
+// a later fix to the file is picked up.
+func (w *PolicyWatcher) Start() error {
+	_, err := w.Check()
+	w.poller.start()
+	return err
+}
+
+// Stop stops polling and waits for the background goroutine to exit
+func (w *PolicyWatcher) Stop() {
+	w.poller.stop()
+}
+
+// Check polls the policy files once and applies the policy if it changed.
+// It reports whether a new policy was applied. Files that are unchanged since
+// they were last rejected, or are still missing, are skipped without an error;
+// LastError still reports why they were rejected. The audit log and the
+// OnReload and OnError callbacks are called without the watcher locked, so they
+// may call back into it.
+func (w *PolicyWatcher) Check() (bool, error) {
+	acl, err := w.check()
+	switch {
+	case err != nil:
+		w.audit(AuditResultError, err.Error())
+		if w.config.OnError != nil {
+			w.config.OnError(err)
+		}
+		return false, err
+	case acl != nil:
+		w.audit(AuditResultAllowed, "policy reloaded")
+		if w.config.OnReload != nil {
+			w.config.OnReload(*acl)
+		}
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// check does the work of Check with the watcher locked. It returns the ACL it
+// applied, or the error it rejected the policy with, or neither if nothing changed.
+func (w *PolicyWatcher) check() (*ACL, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.examined && !w.snapshot.statsChanged() {
+		return nil, nil
+	}
+
+	paths := w.snapshot.paths
+	if !w.examined {
+		paths = []string{w.config.Path}
+	}
+	before := takePolicySnapshot(paths, nil)
+	if w.examined && before.sameContent(w.snapshot) {
+		// Touched but unchanged
+		w.snapshot = before
+		return nil, nil
+	}
+
+	merged, files, err := loadPolicyTree(w.config.Path, w.config.Format)
+	if len(files) == 0 {
+		files = []string{w.config.Path}
+	}
+	// Files read before loading keep that state, so a change made while
+	// loading is seen by the next poll
+	w.snapshot = takePolicySnapshot(files, before.files)
+	w.examined = true
+	if err != nil {
+		// The current policy stays in effect
+		w.lastErr = fmt.Errorf("policy %s rejected: %w", w.config.Path, err)
+		return nil, w.lastErr
+	}
+
+	acl := merged.ACL
+	w.pfs.UpdateACL(func(current *ACL) error {
+		*current = acl
+		return nil
+	})
+	w.lastErr = nil
+	return &acl, nil
+}
+
+// LastError returns the error that caused the most recent rejection,
+// or nil if the last check succeeded
+func (w *PolicyWatcher) LastError() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastErr
+}
+
+func (w *PolicyWatcher) audit(result AuditResult, reason string) {
+	w.pfs.auditLogger.Log(&AuditEvent{
+		Timestamp: w.pfs.clock.Now(),
+		UserID:    "system",
+		Operation: "PolicyReload",
+		Path:      w.config.Path,
+		Result:    result,
+		Reason:    reason,
+	})
+}
+
+// watchedFile is the state of one policy file
+type watchedFile struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+	missing bool
+}
+
+// policySnapshot is the state of the files of a policy tree
+type policySnapshot struct {
+	paths []string
+	files map[string]watchedFile
+}
+
+// takePolicySnapshot stats and hashes paths, reusing the state in known
+func takePolicySnapshot(paths []string, known map[string]watchedFile) policySnapshot {
+	snapshot := policySnapshot{paths: paths, files: make(map[string]watchedFile, len(paths))}
+	for _, path := range paths {
+		if file, ok := known[path]; ok {
+			snapshot.files[path] = file
+			continue
+		}
+		var file watchedFile
+		info, err := os.Stat(path)
+		if err == nil {
+			file.modTime, file.size = info.ModTime(), info.Size()
+			var data []byte
+			if data, err = os.ReadFile(path); err == nil {
+				file.hash = sha256.Sum256(data)
+			}
+		}
+		file.missing = err != nil
+		snapshot.files[path] = file
+	}
+	return snapshot
+}
+
+// statsChanged reports whether any file appeared, disappeared, or has a new
+// modification time or size
+func (s policySnapshot) statsChanged() bool {
+	for _, path := range s.paths {
+		file := s.files[path]
+		info, err := os.Stat(path)
+		if (err != nil) != file.missing {
+			return true
+		}
+		if err == nil && (!info.ModTime().Equal(file.modTime) || info.Size() != file.size) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameContent reports whether both snapshots cover the same files with the same content
+func (s policySnapshot) sameContent(other policySnapshot) bool {
+	if len(s.paths) != len(other.paths) {
+		return false
+	}
+	for i, path := range s.paths {
+		a, b := s.files[path], other.files[path]
+		if path != other.paths[i] || a.missing != b.missing || a.hash != b.hash {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,343 @@
+package permfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePolicy writes content to file and moves its modification time forward
+// so that the change is visible even on filesystems with coarse timestamps
+func writePolicy(t *testing.T, file, content string) {
+	t.Helper()
+	next := time.Now()
+	if info, err := os.Stat(file); err == nil && !next.After(info.ModTime()) {
+		next = info.ModTime().Add(time.Second)
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	if err := os.Chtimes(file, next, next); err != nil {
+		t.Fatalf("failed to set policy mtime: %v", err)
+	}
+}
+
+const watchedPolicyV1 = `{
+  "version": "1.0",
+  "default": "deny",
+  "entries": [
+    {"subject": {"type": "user", "id": "alice"}, "path_pattern": "/data/**", "permissions": ["read"], "effect": "allow", "priority": 100}
+  ]
+}`
+
+const watchedPolicyV2 = `{
+  "version": "1.0",
+  "default": "deny",
+  "entries": [
+    {"subject": {"type": "user", "id": "alice"}, "path_pattern": "/data/**", "permissions": ["read", "write"], "effect": "allow", "priority": 100}
+  ]
+}`
+
+const watchedPolicyInvalid = `{
+  "version": "1.0",
+  "default": "deny",
+  "entries": [
+    {"subject": {"type": "user", "id": "alice"}, "path_pattern": "", "permissions": ["read"], "effect": "allow", "priority": 100}
+  ]
+}`
+
+func TestPolicyWatcher(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, file, watchedPolicyV1)
+
+	var events []*AuditEvent
+	pfs, _ := New(&mockFileSystem{}, Config{
+		ACL: ACL{Default: Deny},
+		Audit: AuditConfig{
+			Enabled: true,
+			Writer:  io.Discard,
+			Handler: func(event *AuditEvent) { events = append(events, event) },
+		},
+	})
+	watcher, err := NewPolicyWatcher(pfs, PolicyWatcherConfig{Path: file, Format: PolicyFormatJSON})
+	if err != nil {
+		t.Fatalf("NewPolicyWatcher failed: %v", err)
+	}
+
+	ctx := WithUser(context.Background(), "alice")
+	canWrite := func() bool {
+		perms, _ := pfs.GetPermissions(ctx, "/data/file.txt")
+		return perms.Has(OperationWrite)
+	}
+
+	if err := watcher.Start(); err != nil {
+		t.Fatalf("initial load failed: %v", err)
+	}
+	defer watcher.Stop()
+	if perms, _ := pfs.GetPermissions(ctx, "/data/file.txt"); perms != Read {
+		t.Fatalf("expected initial policy to grant read, got %s", perms)
+	}
+
+	// Unchanged file is not reloaded
+	if reloaded, err := watcher.Check(); reloaded || err != nil {
+		t.Errorf("expected no reload, got %v, %v", reloaded, err)
+	}
+
+	writePolicy(t, file, watchedPolicyV2)
+	if reloaded, err := watcher.Check(); !reloaded || err != nil {
+		t.Fatalf("expected reload, got %v, %v", reloaded, err)
+	}
+	if !canWrite() {
+		t.Error("expected reloaded policy to grant write")
+	}
+
+	// An invalid policy is rejected and the last good one stays in effect
+	writePolicy(t, file, watchedPolicyInvalid)
+	if _, err := watcher.Check(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig, got %v", err)
+	}
+	if !canWrite() {
+		t.Error("expected last good policy to remain in effect")
+	}
+	if watcher.LastError() == nil {
+		t.Error("expected LastError to report the rejection")
+	}
+
+	writePolicy(t, file, "{not json")
+	if _, err := watcher.Check(); err == nil {
+		t.Error("expected malformed policy to be rejected")
+	}
+
+	var reloads, rejections int
+	for _, event := range events {
+		if event.Operation != "PolicyReload" {
+			continue
+		}
+		switch event.Result {
+		case AuditResultAllowed:
+			reloads++
+		case AuditResultError:
+			rejections++
+		}
+	}
+	if reloads != 2 || rejections != 2 {
+		t.Errorf("expected 2 reload and 2 rejection events, got %d and %d", reloads, rejections)
+	}
+}
+
+func TestPolicyWatcherPolling(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, file, watchedPolicyV1)
+
+	pfs, _ := New(&mockFileSystem{}, Config{ACL: ACL{Default: Deny}})
+	reloaded := make(chan ACL, 4)
+	watcher, _ := NewPolicyWatcher(pfs, PolicyWatcherConfig{
+		Path:     file,
+		Format:   PolicyFormatJSON,
+		Interval: 10 * time.Millisecond,
+		OnReload: func(acl ACL) { reloaded <- acl },
+	})
+	if err := watcher.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer watcher.Stop()
+	<-reloaded
+
+	writePolicy(t, file, watchedPolicyV2)
+	select {
+	case acl := <-reloaded:
+		if acl.Entries[0].Permissions != ReadWrite {
+			t.Errorf("unexpected reloaded ACL: %+v", acl)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("policy change was not picked up")
+	}
+}
+
+func TestPolicyWatcherRejectsOnce(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, file, watchedPolicyV1)
+
+	pfs, _ := New(&mockFileSystem{}, Config{ACL: ACL{Default: Deny}})
+	var errs []error
+	watcher, _ := NewPolicyWatcher(pfs, PolicyWatcherConfig{
+		Path:    file,
+		Format:  PolicyFormatJSON,
+		OnError: func(err error) { errs = append(errs, err) },
+	})
+	if _, err := watcher.Check(); err != nil {
+		t.Fatalf("initial load failed: %v", err)
+	}
+
+	// A broken file is reported once, not on every poll
+	writePolicy(t, file, watchedPolicyInvalid)
+	for i := 0; i < 3; i++ {
+		watcher.Check()
+	}
+	if len(errs) != 1 || watcher.LastError() == nil {
+		t.Errorf("expected one rejection of the unchanged broken file, got %v", errs)
+	}
+
+	// So is a missing file
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		watcher.Check()
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected one rejection of the missing file, got %v", errs)
+	}
+
+	// Fixing the file is picked up
+	writePolicy(t, file, watchedPolicyV2)
+	if reloaded, err := watcher.Check(); !reloaded || err != nil {
+		t.Errorf("expected the fixed policy to be applied, got %v, %v", reloaded, err)
+	}
+	if watcher.LastError() != nil {
+		t.Errorf("expected LastError to clear, got %v", watcher.LastError())
+	}
+}
+
+func TestPolicyWatcherIncludes(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "policy.json")
+	team := filepath.Join(dir, "team.json")
+	writePolicy(t, team, watchedPolicyV1)
+	writePolicy(t, root, `{"version": "1.0", "default": "deny", "include": ["team.json"]}`)
+
+	pfs, _ := New(&mockFileSystem{}, Config{ACL: ACL{Default: Deny}})
+	watcher, _ := NewPolicyWatcher(pfs, PolicyWatcherConfig{Path: root, Format: PolicyFormatJSON})
+	if _, err := watcher.Check(); err != nil {
+		t.Fatalf("initial load failed: %v", err)
+	}
+
+	ctx := WithUser(context.Background(), "alice")
+	permissions := func() Operation {
+		perms, _ := pfs.GetPermissions(ctx, "/data/file.txt")
+		return perms
+	}
+	if perms := permissions(); perms != Read {
+		t.Fatalf("expected the included policy to grant read, got %s", perms)
+	}
+
+	// Changing only the included file reloads the tree
+	writePolicy(t, team, watchedPolicyV2)
+	if reloaded, err := watcher.Check(); !reloaded || err != nil {
+		t.Fatalf("expected the included change to be applied, got %v, %v", reloaded, err)
+	}
+	if perms := permissions(); !perms.Has(OperationWrite) {
+		t.Errorf("expected the included change to grant write, got %s", perms)
+	}
+
+	// A broken include is rejected and the last good tree stays in effect
+	writePolicy(t, team, watchedPolicyInvalid)
+	if _, err := watcher.Check(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig, got %v", err)
+	}
+	if perms := permissions(); !perms.Has(OperationWrite) {
+		t.Errorf("expected last good policy to remain in effect, got %s", perms)
+	}
+
+	// A missing include is rejected, and restoring it is picked up
+	if err := os.Remove(team); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watcher.Check(); err == nil {
+		t.Error("expected a missing include to be rejected")
+	}
+	writePolicy(t, team, watchedPolicyV1)
+	if reloaded, err := watcher.Check(); !reloaded || err != nil {
+		t.Fatalf("expected the restored include to be applied, got %v, %v", reloaded, err)
+	}
+	if perms := permissions(); perms != Read {
+		t.Errorf("expected the restored include to grant read, got %s", perms)
+	}
+}
+
+func TestPolicyWatcherCallbacksReenter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	writePolicy(t, file, watchedPolicyV1)
+
+	pfs, _ := New(&mockFileSystem{}, Config{ACL: ACL{Default: Deny}})
+	var watcher *PolicyWatcher
+	var reloadErr, rejectErr error
+	var recheck bool
+	watcher, _ = NewPolicyWatcher(pfs, PolicyWatcherConfig{
+		Path:   file,
+		Format: PolicyFormatJSON,
+		OnReload: func(ACL) {
+			reloadErr = watcher.LastError()
+			// Nothing changed since, so this returns at once
+			recheck, _ = watcher.Check()
+		},
+		OnError: func(error) { rejectErr = watcher.LastError() },
+	})
+
+	check := func() {
+		t.Helper()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			watcher.Check()
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("a callback calling back into the watcher deadlocked")
+		}
+	}
+	check()
+	writePolicy(t, file, watchedPolicyInvalid)
+	check()
+
+	if reloadErr != nil || recheck {
+		t.Errorf("unexpected state seen from OnReload: %v, %v", reloadErr, recheck)
+	}
+	if rejectErr == nil {
+		t.Error("expected OnError to see the rejection through LastError")
+	}
+}
+
+func TestPolicyWatcherRelativePath(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, filepath.Join(dir, "policy.json"), watchedPolicyV1)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	pfs, _ := New(&mockFileSystem{}, Config{ACL: ACL{Default: Deny}})
+	watcher, err := NewPolicyWatcher(pfs, PolicyWatcherConfig{Path: "policy.json", Format: PolicyFormatJSON})
+	if err != nil {
+		t.Fatalf("NewPolicyWatcher failed: %v", err)
+	}
+	if !filepath.IsAbs(watcher.config.Path) {
+		t.Errorf("expected the path to be made absolute, got %s", watcher.config.Path)
+	}
+	if reloaded, err := watcher.Check(); !reloaded || err != nil {
+		t.Fatalf("initial load failed: %v, %v", reloaded, err)
+	}
+
+	// The root is watched under the same absolute path the loader reports
+	for _, path := range watcher.snapshot.paths {
+		if path != watcher.config.Path {
+			t.Errorf("expected only %s to be watched, got %v", watcher.config.Path, watcher.snapshot.paths)
+		}
+	}
+	if reloaded, _ := watcher.Check(); reloaded {
+		t.Error("expected no reload of an unchanged file")
+	}
+	writePolicy(t, filepath.Join(dir, "policy.json"), watchedPolicyV2)
+	if reloaded, err := watcher.Check(); !reloaded || err != nil {
+		t.Errorf("expected the change to be applied, got %v, %v", reloaded, err)
+	}
+}
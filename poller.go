@@ -0,0 +1,64 @@
+package permfs
+
+import (
+	"sync"
+	"time"
+)
+
+// poller calls a function at a fixed interval in a background goroutine
+type poller struct {
+	interval time.Duration
+	poll     func()
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+}
+
+func newPoller(interval time.Duration, poll func()) *poller {
+	return &poller{
+		interval: interval,
+		poll:     poll,
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+}
+
+// start starts polling in the background. Only the first call has any effect.
+func (p *poller) start() {
+	p.startOnce.Do(func() {
+		go p.run()
+	})
+}
+
+// stop stops polling and waits for the background goroutine to exit.
+// A poller that is stopped before it is started never starts.
+func (p *poller) stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+	})
+	started := true
+	p.startOnce.Do(func() {
+		started = false
+	})
+	if started {
+		<-p.doneCh
+	}
+}
+
+func (p *poller) run() {
+	defer close(p.doneCh)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.poll()
+		case <-p.stopCh:
+			return
+		}
+	}
+}
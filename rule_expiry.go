@@ -0,0 +1,99 @@
+package permfs
+
+import (
+	"errors"
+	"time"
+)
+
+// errNothingExpired aborts an ACL update that would not change anything
+var errNothingExpired = errors.New("no expired rules")
+
+// PruneExpiredRules removes every rule whose NotAfter has passed and returns
+// the removed rules. Each removal is recorded in the audit log.
+func (pfs *PermFS) PruneExpiredRules() []ACLEntry {
+	now := pfs.clock.Now()
+
+	var expired []ACLEntry
+	err := pfs.UpdateACL(func(acl *ACL) error {
+		var kept []ACLEntry
+		for _, entry := range acl.Entries {
+			if entry.ExpiredAt(now) {
+				expired = append(expired, entry)
+			} else {
+				kept = append(kept, entry)
+			}
+		}
+		if len(expired) == 0 {
+			return errNothingExpired
+		}
+		acl.Entries = kept
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range expired {
+		pfs.auditLogger.Log(&AuditEvent{
+			Timestamp: now,
+			UserID:    "system",
+			Operation: "RuleExpired",
+			Path:      entry.PathPattern,
+			Result:    AuditResultAllowed,
+			Reason:    "rule expired: " + entry.String(),
+			RuleID:    entry.ID,
+		})
+	}
+	return expired
+}
+
+// RuleSweeperConfig configures a RuleSweeper
+type RuleSweeperConfig struct {
+	// Interval is how often expired rules are pruned (default: 1m)
+	Interval time.Duration
+	// OnExpire is called with the rules removed by each sweep that removed any
+	OnExpire func(expired []ACLEntry)
+}
+
+// RuleSweeper periodically removes rules whose validity window has ended.
+// Expired rules never grant or deny access whether or not they have been
+// swept; sweeping keeps the ACL small and records the expiry in the audit log.
+type RuleSweeper struct {
+	pfs    *PermFS
+	config RuleSweeperConfig
+	poller *poller
+}
+
+// NewRuleSweeper creates a sweeper for pfs. Nothing is pruned until Start or Sweep is called.
+func NewRuleSweeper(pfs *PermFS, config RuleSweeperConfig) (*RuleSweeper, error) {
+	if pfs == nil {
+		return nil, ErrInvalidConfig
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+
+	s := &RuleSweeper{pfs: pfs, config: config}
+	s.poller = newPoller(config.Interval, func() { s.Sweep() })
+	return s, nil
+}
+
+// Start sweeps once and then sweeps in the background until Stop is called
+func (s *RuleSweeper) Start() {
+	s.Sweep()
+	s.poller.start()
+}
+
+// Stop stops sweeping and waits for the background goroutine to exit
+func (s *RuleSweeper) Stop() {
+	s.poller.stop()
+}
+
+// Sweep prunes expired rules once and returns the rules it removed
+func (s *RuleSweeper) Sweep() []ACLEntry {
+	expired := s.pfs.PruneExpiredRules()
+	if len(expired) > 0 && s.config.OnExpire != nil {
+		s.config.OnExpire(expired)
+	}
+	return expired
+}
@@ -0,0 +1,165 @@
+package permfs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/absfs/permfs/permfstest"
+)
+
+func TestRuleValidityWindow(t *testing.T) {
+	now := time.Now()
+	entries := []ACLEntry{
+		{ID: "future", Subject: User("alice"), PathPattern: "/future/**", Permissions: Read, Effect: Allow, NotBefore: now.Add(time.Hour)},
+		{ID: "past", Subject: User("alice"), PathPattern: "/past/**", Permissions: Read, Effect: Allow, NotAfter: now.Add(-time.Hour)},
+		{ID: "current", Subject: User("alice"), PathPattern: "/current/**", Permissions: Read, Effect: Allow,
+			NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)},
+	}
+	e := NewEvaluator(ACL{Entries: entries, Default: Deny})
+	identity := &Identity{UserID: "alice"}
+
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{"/future/a.txt", false},
+		{"/past/a.txt", false},
+		{"/current/a.txt", true},
+	}
+	for _, tt := range tests {
+		if got := e.CanRead(identity, tt.path); got != tt.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", tt.path, tt.allowed, got)
+		}
+	}
+
+	decision, _ := e.Decide(&EvaluationContext{Identity: identity, Path: "/current/a.txt", Operation: OperationRead})
+	if !decision.ValidUntil.Equal(entries[2].NotAfter) {
+		t.Errorf("expected decision to be valid until %v, got %v", entries[2].NotAfter, decision.ValidUntil)
+	}
+}
+
+func TestRuleExpiryBoundsCache(t *testing.T) {
+	clock := permfstest.NewFakeClock(time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC))
+	mock := &mockFileSystem{shouldReturnFile: true}
+	pfs, err := New(mock, Config{
+		ACL: ACL{
+			Entries: []ACLEntry{
+				{Subject: User("alice"), PathPattern: "/incident/**", Permissions: Read, Effect: Allow,
+					NotAfter: clock.Now().Add(time.Minute)},
+			},
+			Default: Deny,
+		},
+		Performance: PerformanceConfig{
+			CacheEnabled: true,
+			CacheTTL:     time.Hour,
+			CacheMaxSize: 100,
+		},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+	ctx := WithUser(context.Background(), "alice")
+
+	if _, err := pfs.OpenFile(ctx, "/incident/log.txt", os.O_RDONLY, 0); err != nil {
+		t.Fatalf("expected access before expiry: %v", err)
+	}
+	clock.Advance(time.Minute - time.Nanosecond)
+	if _, err := pfs.OpenFile(ctx, "/incident/log.txt", os.O_RDONLY, 0); err != nil {
+		t.Fatalf("expected access until the rule expires: %v", err)
+	}
+	clock.Advance(time.Nanosecond)
+	if _, err := pfs.OpenFile(ctx, "/incident/log.txt", os.O_RDONLY, 0); !IsPermissionDenied(err) {
+		t.Errorf("cached allow outlived the rule: %v", err)
+	}
+}
+
+func TestPruneExpiredRules(t *testing.T) {
+	var events []*AuditEvent
+	pfs, err := New(&mockFileSystem{}, Config{
+		ACL: ACL{
+			Entries: []ACLEntry{
+				{ID: "expired", Subject: User("bob"), PathPattern: "/tmp/**", Permissions: Read, Effect: Allow, NotAfter: time.Now().Add(-time.Minute)},
+				{ID: "permanent", Subject: User("bob"), PathPattern: "/home/bob/**", Permissions: All, Effect: Allow},
+			},
+			Default: Deny,
+		},
+		Audit: AuditConfig{
+			Enabled: true,
+			Writer:  io.Discard,
+			Handler: func(event *AuditEvent) { events = append(events, event) },
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create PermFS: %v", err)
+	}
+
+	var swept []ACLEntry
+	sweeper, err := NewRuleSweeper(pfs, RuleSweeperConfig{
+		Interval: time.Hour,
+		OnExpire: func(expired []ACLEntry) { swept = append(swept, expired...) },
+	})
+	if err != nil {
+		t.Fatalf("NewRuleSweeper failed: %v", err)
+	}
+	sweeper.Start()
+	defer sweeper.Stop()
+
+	if len(swept) != 1 || swept[0].ID != "expired" {
+		t.Fatalf("expected the expired rule to be swept, got %v", swept)
+	}
+	if rules := pfs.ListRules(); len(rules) != 1 || rules[0].ID != "permanent" {
+		t.Errorf("unexpected remaining rules: %v", rules)
+	}
+	if len(events) != 1 || events[0].Operation != "RuleExpired" || events[0].RuleID != "expired" {
+		t.Errorf("expected an expiry audit event, got %+v", events)
+	}
+
+	if expired := sweeper.Sweep(); len(expired) != 0 {
+		t.Errorf("second sweep removed %v", expired)
+	}
+}
+
+func TestRuleValidityWindowPolicyRoundTrip(t *testing.T) {
+	notBefore := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2026, 3, 31, 18, 30, 0, 0, time.UTC)
+	acl := ACL{
+		Default: Deny,
+		Entries: []ACLEntry{
+			{Subject: User("contractor"), PathPattern: "/projects/apollo/**", Permissions: ReadWrite, Effect: Allow,
+				NotBefore: notBefore, NotAfter: notAfter},
+			{Subject: User("alice"), PathPattern: "/home/alice/**", Permissions: All, Effect: Allow},
+		},
+	}
+
+	for _, format := range []PolicyFormat{PolicyFormatJSON, PolicyFormatYAML, PolicyFormatText} {
+		var buf bytes.Buffer
+		if err := SavePolicy(ExportPolicy(acl, ""), &buf, format); err != nil {
+			t.Fatalf("format %d: SavePolicy failed: %v", format, err)
+		}
+		policy, err := LoadPolicy(&buf, format)
+		if err != nil {
+			t.Fatalf("format %d: LoadPolicy failed: %v", format, err)
+		}
+		imported, err := ImportPolicy(policy)
+		if err != nil {
+			t.Fatalf("format %d: ImportPolicy failed: %v", format, err)
+		}
+		if got := imported.Entries[0]; !got.NotBefore.Equal(notBefore) || !got.NotAfter.Equal(notAfter) {
+			t.Errorf("format %d: window not preserved: %v - %v", format, got.NotBefore, got.NotAfter)
+		}
+		if got := imported.Entries[1]; !got.NotBefore.IsZero() || !got.NotAfter.IsZero() {
+			t.Errorf("format %d: unbounded rule gained a window: %v - %v", format, got.NotBefore, got.NotAfter)
+		}
+	}
+
+	inverted := ACLEntry{Subject: User("a"), PathPattern: "/x", Permissions: Read, Effect: Allow,
+		NotBefore: notAfter, NotAfter: notBefore}
+	if result := ValidateACLEntry(inverted); result.Valid {
+		t.Error("expected an inverted validity window to be invalid")
+	}
+}
@@ -0,0 +1,276 @@
+package permfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// walkSubtree visits root and every descendant in pre-order using the base filesystem.
+// Symbolic links are reported but never followed.
+func (pfs *PermFS) walkSubtree(ctx context.Context, root string, fn func(p string, info os.FileInfo) error) error {
+	info, err := pfs.base.Lstat(ctx, root)
+	if err != nil {
+		return err
+	}
+	return pfs.walkNode(ctx, root, info, fn)
+}
+
+func (pfs *PermFS) walkNode(ctx context.Context, p string, info os.FileInfo, fn func(p string, info os.FileInfo) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := fn(p, info); err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return nil
+	}
+
+	children, err := pfs.base.ReadDir(ctx, p)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := pfs.walkNode(ctx, path.Join(p, child.Name()), child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// asPermissionError reports whether err is a permission denial and returns it
+func asPermissionError(err error) (*PermissionError, bool) {
+	var permErr *PermissionError
+	if errors.As(err, &permErr) {
+		return permErr, true
+	}
+	return nil, false
+}
+
+// collectDenied checks op on every descendant of root (root itself excluded)
+// and returns the denials. Errors other than permission denials abort the walk.
+func (pfs *PermFS) collectDenied(ctx context.Context, root string, op Operation) ([]*PermissionError, error) {
+	var denied []*PermissionError
+	err := pfs.walkSubtree(ctx, root, func(p string, info os.FileInfo) error {
+		if p == root {
+			return nil
+		}
+		if err := pfs.checkPermission(ctx, p, op); err != nil {
+			permErr, ok := asPermissionError(err)
+			if !ok {
+				return err
+			}
+			denied = append(denied, permErr)
+		}
+		return nil
+	})
+	return denied, err
+}
+
+// removeAllPreflight refuses the whole RemoveAll if any descendant is protected
+func (pfs *PermFS) removeAllPreflight(ctx context.Context, name string) error {
+	denied, err := pfs.collectDenied(ctx, name, OperationDelete)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// Nothing to check; let the base report RemoveAll semantics
+			return pfs.base.RemoveAll(ctx, name)
+		}
+		return err
+	}
+	if len(denied) > 0 {
+		return &MultiPathError{Op: "removeall", Path: name, Denied: denied}
+	}
+	return pfs.base.RemoveAll(ctx, name)
+}
+
+// removeAllPartial removes every permitted path below and including name,
+// keeping denied paths and any directory that still contains them
+func (pfs *PermFS) removeAllPartial(ctx context.Context, name string) error {
+	info, err := pfs.base.Lstat(ctx, name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	var denied []*PermissionError
+	if _, err := pfs.removePermitted(ctx, name, info, false, &denied); err != nil {
+		return err
+	}
+	if len(denied) > 0 {
+		return &MultiPathError{Op: "removeall", Path: name, Denied: denied}
+	}
+	return nil
+}
+
+// removePermitted removes p bottom-up and reports whether it is gone.
+// checkSelf is false for the root, whose permission has already been checked.
+func (pfs *PermFS) removePermitted(ctx context.Context, p string, info os.FileInfo, checkSelf bool, denied *[]*PermissionError) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	allowed := true
+	if checkSelf {
+		if err := pfs.checkPermission(ctx, p, OperationDelete); err != nil {
+			permErr, ok := asPermissionError(err)
+			if !ok {
+				return false, err
+			}
+			*denied = append(*denied, permErr)
+			allowed = false
+		}
+	}
+
+	// Descend even into denied directories: their children may still be deletable
+	empty := true
+	if info.IsDir() {
+		children, err := pfs.base.ReadDir(ctx, p)
+		if err != nil {
+			return false, err
+		}
+		for _, child := range children {
+			removed, err := pfs.removePermitted(ctx, path.Join(p, child.Name()), child, true, denied)
+			if err != nil {
+				return false, err
+			}
+			if !removed {
+				empty = false
+			}
+		}
+	}
+
+	if !allowed || !empty {
+		return false, nil
+	}
+	if err := pfs.base.Remove(ctx, p); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// renameSubtree checks every path moved by a rename before delegating to the base.
+// The endpoints themselves have already been checked by Rename.
+func (pfs *PermFS) renameSubtree(ctx context.Context, oldname, newname string) error {
+	identity, err := GetIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	root := path.Clean(oldname)
+	policy := pfs.config.Enforcement.RenameEscalation
+	// Escalation compares what the caller could do at each end in this request
+	request := EvaluationContext{
+		Identity: identity,
+		Metadata: GetMetadata(ctx),
+		Time:     pfs.clock.Now(),
+	}
+
+	var denied []*PermissionError
+	deny := func(err error) error {
+		permErr, ok := asPermissionError(err)
+		if !ok {
+			return err
+		}
+		denied = append(denied, permErr)
+		return nil
+	}
+
+	err = pfs.walkSubtree(ctx, root, func(src string, info os.FileInfo) error {
+		dst := path.Join(newname, strings.TrimPrefix(src, root))
+
+		if src != root {
+			if err := pfs.checkPermission(ctx, src, OperationDelete); err != nil {
+				if err := deny(err); err != nil {
+					return err
+				}
+			}
+			if err := pfs.checkPermission(ctx, dst, OperationWrite); err != nil {
+				if err := deny(err); err != nil {
+					return err
+				}
+			}
+		}
+
+		if policy == RenameEscalationAllow {
+			return nil
+		}
+		request.Path = dst
+		gained := pfs.evaluator.effectivePermissions(request)
+		request.Path = src
+		gained &^= pfs.evaluator.effectivePermissions(request)
+		if gained == 0 {
+			return nil
+		}
+		if policy == RenameEscalationRequireAdmin {
+			if err := pfs.checkPermission(ctx, src, OperationAdmin); err != nil {
+				return deny(err)
+			}
+			return nil
+		}
+		return deny(NewPermissionError(src, OperationAdmin, identity.UserID,
+			fmt.Sprintf("moving to %s would grant %s", dst, gained)))
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if len(denied) > 0 {
+		return &MultiPathError{Op: "rename", Path: oldname, Denied: denied}
+	}
+	return pfs.base.Rename(ctx, oldname, newname)
+}
+
+// missingAncestors returns the ancestors of name that do not exist yet, outermost first
+func (pfs *PermFS) missingAncestors(ctx context.Context, name string) ([]string, error) {
+	var missing []string
+	p := path.Clean(filepath.ToSlash(name))
+	for dir := path.Dir(p); dir != "/" && dir != "."; dir = path.Dir(dir) {
+		_, err := pfs.base.Lstat(ctx, dir)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		missing = append(missing, dir)
+	}
+
+	for i, j := 0, len(missing)-1; i < j; i, j = i+1, j-1 {
+		missing[i], missing[j] = missing[j], missing[i]
+	}
+	return missing, nil
+}
+
+// checkMkdirAllAncestors requires Write for every intermediate directory MkdirAll
+// would create and reports the first refused component. The leaf has already been checked.
+func (pfs *PermFS) checkMkdirAllAncestors(ctx context.Context, name string) error {
+	missing, err := pfs.missingAncestors(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	targets := missing
+	if pfs.config.Enforcement.MkdirAll == MkdirAllCheckParents {
+		targets = make([]string, 0, len(missing)+1)
+		for _, dir := range append(missing, path.Clean(filepath.ToSlash(name))) {
+			targets = append(targets, path.Dir(dir))
+		}
+	}
+
+	for _, target := range targets {
+		if err := pfs.checkPermission(ctx, target, OperationWrite); err != nil {
+			if permErr, ok := asPermissionError(err); ok {
+				permErr.Reason = fmt.Sprintf("required to create %s: %s", name, permErr.Reason)
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -179,6 +179,76 @@ type Condition interface {
 	String() string
 }
 
+// CacheSafeCondition is implemented by conditions whose outcome is fully
+// determined by the request's identity and the metadata keys they read.
+// Decisions in which any other condition took part are never cached.
+type CacheSafeCondition interface {
+	Condition
+	// CacheSafe reports whether the outcome may be cached; a composite
+	// condition is cache-safe only if all of its parts are
+	CacheSafe() bool
+	// MetadataKeys returns the EvaluationContext.Metadata keys the condition reads
+	MetadataKeys() []string
+}
+
+// CacheHintCondition is implemented by cache-safe conditions whose outcome can
+// also change over time or should sometimes not be cached. A cached decision is
+// kept no longer than the earliest ValidUntil of the conditions consulted for it.
+type CacheHintCondition interface {
+	CacheSafeCondition
+	// CacheHint reports whether the outcome for ctx may be cached and until when;
+	// a zero time means no limit beyond the cache TTL
+	CacheHint(ctx *EvaluationContext) (cacheable bool, validUntil time.Time)
+}
+
+// isCacheSafe reports whether a condition declares itself cache-safe
+func isCacheSafe(cond Condition) bool {
+	cs, ok := cond.(CacheSafeCondition)
+	return ok && cs.CacheSafe()
+}
+
+// conditionsCacheSafe reports whether every condition is cache-safe
+func conditionsCacheSafe(conditions []Condition) bool {
+	for _, cond := range conditions {
+		if !isCacheSafe(cond) {
+			return false
+		}
+	}
+	return true
+}
+
+// conditionsCacheHint combines the cache hints of the conditions for ctx
+func conditionsCacheHint(conditions []Condition, ctx *EvaluationContext) (cacheable bool, validUntil time.Time) {
+	cacheable = true
+	for _, cond := range conditions {
+		if hinted, ok := cond.(CacheHintCondition); ok {
+			condCacheable, condUntil := hinted.CacheHint(ctx)
+			cacheable = cacheable && condCacheable
+			validUntil = earliest(validUntil, condUntil)
+		}
+	}
+	return cacheable, validUntil
+}
+
+// earliest returns the earlier of two times, where zero means unbounded
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// conditionsMetadataKeys returns the metadata keys read by the cache-safe conditions
+func conditionsMetadataKeys(conditions []Condition) []string {
+	var keys []string
+	for _, cond := range conditions {
+		if cs, ok := cond.(CacheSafeCondition); ok && cs.CacheSafe() {
+			keys = append(keys, cs.MetadataKeys()...)
+		}
+	}
+	return keys
+}
+
 // EvaluationContext contains information needed to evaluate permissions
 type EvaluationContext struct {
 	// Identity contains user, group, and role information
@@ -189,6 +259,17 @@ type EvaluationContext struct {
 	Operation Operation
 	// Metadata contains additional context information
 	Metadata map[string]interface{}
+	// Time is when the request is evaluated. When it is zero an Evaluator uses its
+	// clock, and code evaluating without one, such as ACLEntry.Matches, uses SystemClock.
+	Time time.Time
+}
+
+// now returns the time of the request, or SystemClock's time if none is set
+func (ctx *EvaluationContext) now() time.Time {
+	if ctx.Time.IsZero() {
+		return SystemClock.Now()
+	}
+	return ctx.Time
 }
 
 // Identity represents a user's identity and group memberships
@@ -253,34 +334,103 @@ type ACLEntry struct {
 	Priority int
 	// Conditions are optional conditions that must be satisfied
 	Conditions []Condition
+	// Conceal makes a deny rule hide the paths it matches: Stat, Lstat, OpenFile
+	// and ReadDir report fs.ErrNotExist to subjects with no rights on them
+	Conceal bool
+	// ID identifies the rule; it is optional but must be unique within an ACL
+	ID string
+	// Name is a short human-readable label
+	Name string
+	// Description records why the rule exists, such as its owner or ticket
+	Description string
+	// Tags group related rules for ListRules
+	Tags []string
+	// NotBefore is when the rule takes effect; zero means it always has
+	NotBefore time.Time
+	// NotAfter is when the rule stops having effect; zero means never
+	NotAfter time.Time
 }
 
 // String returns a string representation of the ACL entry
 func (e ACLEntry) String() string {
-	return fmt.Sprintf("%s: %s %s on %s (priority: %d)",
+	s := fmt.Sprintf("%s: %s %s on %s (priority: %d)",
 		e.Subject, e.Effect, e.Permissions, e.PathPattern, e.Priority)
+	if e.ID != "" {
+		s = fmt.Sprintf("[%s] %s", e.ID, s)
+	}
+	return s
+}
+
+// HasTags reports whether the entry carries every one of tags
+func (e ACLEntry) HasTags(tags ...string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range e.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ActiveAt reports whether t lies within the entry's validity window.
+// The window includes NotBefore and excludes NotAfter.
+func (e ACLEntry) ActiveAt(t time.Time) bool {
+	if !e.NotBefore.IsZero() && t.Before(e.NotBefore) {
+		return false
+	}
+	return e.NotAfter.IsZero() || t.Before(e.NotAfter)
+}
+
+// ExpiredAt reports whether the entry's validity window has ended at t
+func (e ACLEntry) ExpiredAt(t time.Time) bool {
+	return !e.NotAfter.IsZero() && !t.Before(e.NotAfter)
+}
+
+// nextTransition returns the first time after t at which the entry becomes
+// active or inactive, or the zero time if it never changes again
+func (e ACLEntry) nextTransition(t time.Time) time.Time {
+	if !e.NotBefore.IsZero() && t.Before(e.NotBefore) {
+		return e.NotBefore
+	}
+	if !e.NotAfter.IsZero() && t.Before(e.NotAfter) {
+		return e.NotAfter
+	}
+	return time.Time{}
 }
 
 // Matches checks if this entry applies to the given context
 func (e ACLEntry) Matches(ctx *EvaluationContext) bool {
+	return e.ActiveAt(ctx.now()) && e.matchesRequest(ctx)
+}
+
+// matchesRequest checks the subject, path and conditions, ignoring the validity window
+func (e ACLEntry) matchesRequest(ctx *EvaluationContext) bool {
 	// Check if subject matches
 	if !ctx.Identity.Matches(e.Subject) {
 		return false
 	}
 
-	// Check if path matches pattern (to be implemented in pattern.go)
-	matched, err := matchPattern(e.PathPattern, ctx.Path)
-	if err != nil || !matched {
+	// Check if path matches pattern, as the evaluator's compiled matchers do
+	if !compilePattern(e.PathPattern).matchClean(normalizePatternPath(ctx.Path)) {
 		return false
 	}
 
-	// Check all conditions
+	return e.conditionsHold(ctx)
+}
+
+// conditionsHold checks that all of the entry's conditions are satisfied
+func (e ACLEntry) conditionsHold(ctx *EvaluationContext) bool {
 	for _, cond := range e.Conditions {
 		if !cond.Evaluate(ctx) {
 			return false
 		}
 	}
-
 	return true
 }
 
@@ -295,6 +445,8 @@ type ACL struct {
 	Entries []ACLEntry
 	// Default is the default effect when no rules match
 	Default Effect
+	// Combining selects how matching rules are combined (default: CombinePriority)
+	Combining CombiningAlgorithm
 }
 
 // Config contains configuration for a permission filesystem
@@ -305,6 +457,134 @@ type Config struct {
 	Audit AuditConfig
 	// Performance configuration (placeholder for Phase 2)
 	Performance PerformanceConfig
+	// Enforcement controls checks for operations that touch more than one path
+	Enforcement EnforcementConfig
+	// Clock supplies the time for time-based rules, cache expiry and audit
+	// timestamps (default: SystemClock)
+	Clock Clock
+}
+
+// RemoveAllMode selects how RemoveAll enforces permissions on descendants
+type RemoveAllMode int
+
+const (
+	// RemoveAllCheckRoot only checks Delete on the path passed to RemoveAll
+	RemoveAllCheckRoot RemoveAllMode = iota
+	// RemoveAllPreflight checks Delete on every descendant first and refuses
+	// the whole operation if any of them is denied
+	RemoveAllPreflight
+	// RemoveAllPartial deletes every descendant that is permitted, keeps the
+	// denied ones (and the directories containing them) and reports them
+	RemoveAllPartial
+)
+
+// String returns a string representation of the mode
+func (m RemoveAllMode) String() string {
+	switch m {
+	case RemoveAllCheckRoot:
+		return "CheckRoot"
+	case RemoveAllPreflight:
+		return "Preflight"
+	case RemoveAllPartial:
+		return "Partial"
+	default:
+		return "Unknown"
+	}
+}
+
+// RenameMode selects how Rename enforces permissions on the paths it moves
+type RenameMode int
+
+const (
+	// RenameCheckSubtree checks Delete on the old path and Write on the new path,
+	// and requires every moved descendant to be deletable at its source and
+	// writable at its destination
+	RenameCheckSubtree RenameMode = iota
+	// RenameCheckEndpoints checks Delete on the old path and Write on the new path only
+	RenameCheckEndpoints
+)
+
+// String returns a string representation of the mode
+func (m RenameMode) String() string {
+	switch m {
+	case RenameCheckSubtree:
+		return "CheckSubtree"
+	case RenameCheckEndpoints:
+		return "CheckEndpoints"
+	default:
+		return "Unknown"
+	}
+}
+
+// RenameEscalationPolicy decides what a subtree rename requires when a moved
+// path would give the caller permissions at its destination that it lacks at its source
+type RenameEscalationPolicy int
+
+const (
+	// RenameEscalationAllow places no extra requirement on escalating moves
+	RenameEscalationAllow RenameEscalationPolicy = iota
+	// RenameEscalationRequireAdmin requires Admin on the source of every escalating path
+	RenameEscalationRequireAdmin
+	// RenameEscalationDeny refuses any rename that would escalate a path
+	RenameEscalationDeny
+)
+
+// String returns a string representation of the policy
+func (p RenameEscalationPolicy) String() string {
+	switch p {
+	case RenameEscalationAllow:
+		return "Allow"
+	case RenameEscalationRequireAdmin:
+		return "RequireAdmin"
+	case RenameEscalationDeny:
+		return "Deny"
+	default:
+		return "Unknown"
+	}
+}
+
+// MkdirAllMode selects which permission MkdirAll requires for the
+// intermediate directories it has to create
+type MkdirAllMode int
+
+const (
+	// MkdirAllCheckCreated requires Write on every directory that will be created
+	MkdirAllCheckCreated MkdirAllMode = iota
+	// MkdirAllCheckParents requires Write on the parent of every directory that will be created
+	MkdirAllCheckParents
+)
+
+// String returns a string representation of the mode
+func (m MkdirAllMode) String() string {
+	switch m {
+	case MkdirAllCheckCreated:
+		return "CheckCreated"
+	case MkdirAllCheckParents:
+		return "CheckParents"
+	default:
+		return "Unknown"
+	}
+}
+
+// EnforcementConfig contains settings for operations that affect a whole subtree
+type EnforcementConfig struct {
+	// MkdirAll selects how MkdirAll checks missing intermediate directories
+	MkdirAll MkdirAllMode
+	// RemoveAll selects how RemoveAll checks the descendants of its target
+	RemoveAll RemoveAllMode
+	// Rename selects how Rename checks the paths it moves (default: RenameCheckSubtree)
+	Rename RenameMode
+	// RenameEscalation applies when Rename is RenameCheckSubtree
+	RenameEscalation RenameEscalationPolicy
+	// ListFilter, when non-zero, hides directory entries on which the caller
+	// lacks these operations (e.g. OperationMetadata or OperationRead).
+	// It applies to ReadDir and to directory reads through open handles, and
+	// each entry's check is audited like any other request.
+	ListFilter Operation
+	// Conceal, when true, makes denied Stat, Lstat, OpenFile and ReadDir calls on
+	// paths the caller has no rights to report fs.ErrNotExist instead of a
+	// PermissionError. The audit log still records the denial.
+	Conceal bool
 }
 
 // AuditConfig contains audit logging configuration (Phase 3)
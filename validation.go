@@ -3,7 +3,9 @@ package permfs
 import (
 	"fmt"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 )
 
 // ValidationError represents a validation error
@@ -37,9 +39,19 @@ func ValidateACL(acl ACL) ValidationResult {
 	result := ValidationResult{Valid: true}
 
 	// Validate entries
+	ids := make(map[string]int)
 	for i, entry := range acl.Entries {
 		prefix := fmt.Sprintf("entries[%d]", i)
 		validateEntry(entry, prefix, &result)
+
+		if entry.ID == "" {
+			continue
+		}
+		if first, ok := ids[entry.ID]; ok {
+			result.AddError(prefix+".id", fmt.Sprintf("duplicate rule ID %q (also used by entries[%d])", entry.ID, first))
+		} else {
+			ids[entry.ID] = i
+		}
 	}
 
 	return result
@@ -80,6 +92,11 @@ func validateEntry(entry ACLEntry, prefix string, result *ValidationResult) {
 	if entry.Priority < 0 {
 		result.AddError(prefix+".priority", "priority cannot be negative")
 	}
+
+	// Validate validity window
+	if !entry.NotBefore.IsZero() && !entry.NotAfter.IsZero() && !entry.NotAfter.After(entry.NotBefore) {
+		result.AddError(prefix+".not_after", "not_after must be later than not_before")
+	}
 }
 
 // validatePathPattern validates a path pattern
@@ -110,27 +127,30 @@ func (pfs *PermFS) TestPermission(identity *Identity, path string, op Operation)
 		Path:      path,
 		Operation: op,
 		Metadata:  make(map[string]interface{}),
+		Time:      pfs.clock.Now(),
 	}
 
-	allowed, _ := pfs.evaluator.Evaluate(evalCtx)
+	decision, _ := pfs.evaluator.Decide(evalCtx)
 
 	// Find matching entries for the test result
 	var matchingEntries []ACLEntry
-	for _, entry := range pfs.evaluator.acl.Entries {
-		if entry.Matches(evalCtx) && entry.Applies(op) {
+	for _, entry := range pfs.evaluator.GetMatchingEntries(evalCtx) {
+		if entry.Applies(op) {
 			matchingEntries = append(matchingEntries, entry)
 		}
 	}
 
 	result := &PermissionTestResult{
-		Allowed:         allowed,
+		Allowed:         decision.Allowed,
 		MatchingEntries: matchingEntries,
 		Path:            path,
 		Operation:       op,
 		Identity:        identity,
+		Algorithm:       decision.Algorithm,
+		RuleID:          decision.RuleID,
 	}
 
-	return allowed, result
+	return decision.Allowed, result
 }
 
 // PermissionTestResult contains the result of a permission test
@@ -140,6 +160,10 @@ type PermissionTestResult struct {
 	Path            string
 	Operation       Operation
 	Identity        *Identity
+	// Algorithm is the combining algorithm that produced the decision
+	Algorithm CombiningAlgorithm
+	// RuleID is the ID of the deciding rule, if it has one
+	RuleID string
 }
 
 // Explain returns a human-readable explanation of the permission decision
@@ -148,7 +172,12 @@ func (ptr *PermissionTestResult) Explain() string {
 
 	sb.WriteString(fmt.Sprintf("Permission Test: %s attempting %s on %s\n",
 		ptr.Identity.UserID, ptr.Operation, ptr.Path))
-	sb.WriteString(fmt.Sprintf("Result: %s\n\n", allowedString(ptr.Allowed)))
+	sb.WriteString(fmt.Sprintf("Result: %s\n", allowedString(ptr.Allowed)))
+	sb.WriteString(fmt.Sprintf("Combining algorithm: %s\n", ptr.Algorithm))
+	if ptr.RuleID != "" {
+		sb.WriteString(fmt.Sprintf("Decided by rule: %s\n", ptr.RuleID))
+	}
+	sb.WriteString("\n")
 
 	if len(ptr.MatchingEntries) == 0 {
 		sb.WriteString("No matching rules found (using default policy)\n")
@@ -169,7 +198,9 @@ func allowedString(allowed bool) string {
 	return "DENIED"
 }
 
-// FindConflictingRules finds rules that might conflict with each other
+// FindConflictingRules finds rules that might conflict with each other.
+// Under CombineMostSpecific and CombinePrioritySpecific, rules whose patterns
+// differ in PatternSpecificity are not reported since the more specific one wins.
 func FindConflictingRules(acl ACL) []RuleConflict {
 	var conflicts []RuleConflict
 
@@ -179,7 +210,7 @@ func FindConflictingRules(acl ACL) []RuleConflict {
 			entry2 := acl.Entries[j]
 
 			// Check if rules might conflict
-			if rulesCanConflict(entry1, entry2) {
+			if rulesCanConflict(entry1, entry2) && !resolvedBySpecificity(acl.Combining, entry1, entry2) {
 				conflicts = append(conflicts, RuleConflict{
 					Rule1:       entry1,
 					Rule2:       entry2,
@@ -192,6 +223,15 @@ func FindConflictingRules(acl ACL) []RuleConflict {
 	return conflicts
 }
 
+// resolvedBySpecificity reports whether the combining algorithm settles a tie
+// between the two rules because one pattern is more specific than the other
+func resolvedBySpecificity(algorithm CombiningAlgorithm, rule1, rule2 ACLEntry) bool {
+	if algorithm != CombineMostSpecific && algorithm != CombinePrioritySpecific {
+		return false
+	}
+	return PatternSpecificity(rule1.PathPattern) != PatternSpecificity(rule2.PathPattern)
+}
+
 // RuleConflict represents a potential conflict between two rules
 type RuleConflict struct {
 	Rule1       ACLEntry
@@ -256,11 +296,18 @@ func describeConflict(rule1, rule2 ACLEntry) string {
 		rule1.Priority, rule1.Effect, rule2.Effect)
 }
 
-// OptimizeACL optimizes an ACL by removing redundant rules
+// OptimizeACL optimizes an ACL by removing redundant rules.
+// Under first-applicable combining the entries are kept as they are, since
+// their order decides.
 func OptimizeACL(acl ACL) ACL {
 	optimized := ACL{
-		Default: acl.Default,
-		Entries: make([]ACLEntry, 0, len(acl.Entries)),
+		Default:   acl.Default,
+		Combining: acl.Combining,
+		Entries:   make([]ACLEntry, 0, len(acl.Entries)),
+	}
+	if acl.Combining == CombineFirstApplicable {
+		optimized.Entries = append(optimized.Entries, acl.Entries...)
+		return optimized
 	}
 
 	// Remove duplicate entries
@@ -276,8 +323,27 @@ func OptimizeACL(acl ACL) ACL {
 	return optimized
 }
 
+// entryKey identifies an entry by every field that affects its evaluation or
+// identity. Conditions are compared by identity, so entries only share a key
+// when they share their condition values.
 func entryKey(entry ACLEntry) string {
-	return fmt.Sprintf("%s:%s:%s:%d:%d",
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:%q:%q:%d:%d:%d:%t:%q:%q:%q:%q:%s:%s",
 		entry.Subject.Type, entry.Subject.ID,
-		entry.PathPattern, entry.Permissions, entry.Effect)
+		entry.PathPattern, entry.Permissions, entry.Effect, entry.Priority,
+		entry.Conceal, entry.ID, entry.Name, entry.Description, entry.Tags,
+		entry.NotBefore.UTC().Format(time.RFC3339Nano), entry.NotAfter.UTC().Format(time.RFC3339Nano))
+	for _, cond := range entry.Conditions {
+		b.WriteString(":")
+		b.WriteString(conditionKey(cond))
+	}
+	return b.String()
+}
+
+// conditionKey identifies a condition value
+func conditionKey(cond Condition) string {
+	if v := reflect.ValueOf(cond); v.Kind() == reflect.Ptr {
+		return fmt.Sprintf("%T@%x", cond, v.Pointer())
+	}
+	return fmt.Sprintf("%#v", cond)
 }
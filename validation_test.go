@@ -2,6 +2,7 @@ package permfs
 
 import (
 	"testing"
+	"time"
 )
 
 func TestValidateACL(t *testing.T) {
@@ -96,6 +97,30 @@ func TestValidateACL(t *testing.T) {
 			expectValid: false,
 			errorCount:  1,
 		},
+		{
+			name: "duplicate rule ID",
+			acl: ACL{
+				Default: Deny,
+				Entries: []ACLEntry{
+					{
+						ID:          "home",
+						Subject:     User("alice"),
+						PathPattern: "/home/alice/**",
+						Permissions: Read,
+						Effect:      Allow,
+					},
+					{
+						ID:          "home",
+						Subject:     User("bob"),
+						PathPattern: "/home/bob/**",
+						Permissions: Read,
+						Effect:      Allow,
+					},
+				},
+			},
+			expectValid: false,
+			errorCount:  1,
+		},
 	}
 
 	for _, tt := range tests {
@@ -217,6 +242,53 @@ func TestTestPermission(t *testing.T) {
 	}
 }
 
+func TestTestPermissionAgreesWithEvaluation(t *testing.T) {
+	patterns := []string{
+		"/data/**",
+		"/data/**/*.log",
+		"/data/**/cache/**",
+		"/data/[a-c]*",
+		"/data/x?",
+		"data/./exact.txt",
+		"/data/[",
+	}
+	paths := []string{
+		"/data",
+		"/data/a.txt",
+		"/data/xy",
+		"/data/exact.txt",
+		"/data/sub/app.log",
+		"/data/sub/cache/blob",
+		"/data/[",
+		"/other/a.txt",
+	}
+
+	identity := &Identity{UserID: "alice"}
+	for _, pattern := range patterns {
+		entry := ACLEntry{Subject: User("alice"), PathPattern: pattern, Permissions: OperationRead, Effect: Allow}
+		acl := ACL{Default: Deny, Entries: []ACLEntry{entry}}
+		pfs, err := New(&mockFileSystem{shouldReturnFile: true}, Config{ACL: acl})
+		if err != nil {
+			t.Fatalf("Failed to create PermFS: %v", err)
+		}
+		merged := &MergedPolicy{ACL: acl, Sources: make([]PolicySource, 1)}
+
+		for _, path := range paths {
+			allowed, result := pfs.TestPermission(identity, path, OperationRead)
+			ctx := &EvaluationContext{Identity: identity, Path: path, Operation: OperationRead, Time: time.Now()}
+			if got := len(result.MatchingEntries) > 0; got != allowed {
+				t.Errorf("%s on %s: allowed=%v but matching entries=%v", pattern, path, allowed, got)
+			}
+			if got := entry.Matches(ctx); got != allowed {
+				t.Errorf("%s on %s: allowed=%v but Matches=%v", pattern, path, allowed, got)
+			}
+			if got := len(merged.EffectiveRules(path)) > 0; got != allowed {
+				t.Errorf("%s on %s: allowed=%v but EffectiveRules=%v", pattern, path, allowed, got)
+			}
+		}
+	}
+}
+
 func TestFindConflictingRules(t *testing.T) {
 	acl := ACL{
 		Default: Deny,
@@ -288,6 +360,36 @@ func TestOptimizeACL(t *testing.T) {
 	}
 }
 
+func TestOptimizeACLKeepsCombining(t *testing.T) {
+	allow := ACLEntry{Subject: User("alice"), PathPattern: "/data/**", Permissions: Read, Effect: Allow}
+	deny := ACLEntry{Subject: Everyone(), PathPattern: "/data/**", Permissions: Read, Effect: Deny}
+	acl := ACL{
+		Default:   Deny,
+		Combining: CombineDenyOverrides,
+		Entries:   []ACLEntry{allow, deny, allow},
+	}
+
+	optimized := OptimizeACL(acl)
+	if optimized.Combining != CombineDenyOverrides {
+		t.Errorf("expected the combining algorithm to be kept, got %s", optimized.Combining)
+	}
+	if len(optimized.Entries) != 2 {
+		t.Errorf("expected the duplicate to be removed, got %d entries", len(optimized.Entries))
+	}
+
+	// First-applicable depends on list order, so nothing is removed
+	acl.Combining = CombineFirstApplicable
+	optimized = OptimizeACL(acl)
+	if optimized.Combining != CombineFirstApplicable || len(optimized.Entries) != 3 {
+		t.Errorf("expected first-applicable entries to be kept, got %s with %d entries",
+			optimized.Combining, len(optimized.Entries))
+	}
+	alice := &Identity{UserID: "alice"}
+	if NewEvaluator(optimized).CanRead(alice, "/data/x") != NewEvaluator(acl).CanRead(alice, "/data/x") {
+		t.Error("optimizing changed the decision")
+	}
+}
+
 func TestPermissionTestResultExplain(t *testing.T) {
 	identity := &Identity{UserID: "alice"}
 	result := &PermissionTestResult{
@@ -759,6 +861,44 @@ func TestEntryKey(t *testing.T) {
 	}
 }
 
+func TestEntryKeyCoversEveryField(t *testing.T) {
+	cond := &MetadataCondition{Key: "env", Values: []string{"prod"}}
+	base := ACLEntry{
+		Subject:     User("alice"),
+		PathPattern: "/data/**",
+		Permissions: Read,
+		Effect:      Allow,
+		Conditions:  []Condition{cond},
+	}
+	window := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	same := base
+	same.Conditions = []Condition{cond}
+	if entryKey(base) != entryKey(same) {
+		t.Error("entries sharing their conditions should have the same key")
+	}
+
+	variants := map[string]func(*ACLEntry){
+		"priority":     func(e *ACLEntry) { e.Priority = 10 },
+		"conceal":      func(e *ACLEntry) { e.Conceal = true },
+		"id":           func(e *ACLEntry) { e.ID = "r1" },
+		"name":         func(e *ACLEntry) { e.Name = "data" },
+		"description":  func(e *ACLEntry) { e.Description = "owner: ops" },
+		"tags":         func(e *ACLEntry) { e.Tags = []string{"temp"} },
+		"not before":   func(e *ACLEntry) { e.NotBefore = window },
+		"not after":    func(e *ACLEntry) { e.NotAfter = window },
+		"conditions":   func(e *ACLEntry) { e.Conditions = []Condition{&MetadataCondition{Key: "env", Values: []string{"dev"}}} },
+		"no condition": func(e *ACLEntry) { e.Conditions = nil },
+	}
+	for name, modify := range variants {
+		entry := base
+		modify(&entry)
+		if entryKey(entry) == entryKey(base) {
+			t.Errorf("%s: entries differing only in %s should have different keys", name, name)
+		}
+	}
+}
+
 func TestPermissionTestResultExplainAllowed(t *testing.T) {
 	identity := &Identity{UserID: "alice"}
 	result := &PermissionTestResult{